@@ -0,0 +1,79 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"slices"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// baggageHeader is the header the W3C baggage propagator uses.
+const baggageHeader = "baggage"
+
+// BaggageRule promotes a plain Kafka header of consumed messages to a baggage
+// member.
+type BaggageRule struct {
+	// Header is the key of the promoted header.
+	Header string
+	// Member is the key of the baggage member. Header is used when empty.
+	Member string
+}
+
+// withBaggage returns p, composed with the W3C baggage propagator unless p
+// already propagates baggage.
+func withBaggage(p propagation.TextMapPropagator) propagation.TextMapPropagator {
+	if slices.Contains(p.Fields(), baggageHeader) {
+		return p
+	}
+	return propagation.NewCompositeTextMapPropagator(p, propagation.Baggage{})
+}
+
+// promoteHeaders returns a copy of ctx whose baggage holds the members that
+// the BaggageRules of c promote from the headers of msg. Members already in
+// the baggage of ctx are kept, as are headers that are not valid members.
+func (c *Config) promoteHeaders(ctx context.Context, msg *kafka.Message) context.Context {
+	if len(c.BaggageRules) == 0 {
+		return ctx
+	}
+
+	bag := baggage.FromContext(ctx)
+	carrier := NewMessageCarrier(msg)
+	for _, rule := range c.BaggageRules {
+		key := rule.Member
+		if key == "" {
+			key = rule.Header
+		}
+		value := carrier.Get(rule.Header)
+		if value == "" || bag.Member(key).Key() != "" {
+			continue
+		}
+		member, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			continue
+		}
+		if b, err := bag.SetMember(member); err == nil {
+			bag = b
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// baggageAttributes returns the members of the baggage of ctx selected with
+// the BaggageAttributes of c, as attributes named after their key.
+func (c *Config) baggageAttributes(ctx context.Context) []attribute.KeyValue {
+	if len(c.BaggageAttributes) == 0 {
+		return nil
+	}
+
+	bag := baggage.FromContext(ctx)
+	var attrs []attribute.KeyValue
+	for _, key := range c.BaggageAttributes {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, attribute.String(key, member.Value()))
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,100 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestReaderPropagatesBaggage(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	fetched := kafka.Message{Topic: "orders", Headers: []kafka.Header{
+		{Key: "baggage", Value: []byte("user.id=42")},
+		{Key: "x-tenant-id", Value: []byte("acme")},
+		{Key: "correlation.id", Value: []byte("c-1")},
+		{Key: "x-user-id", Value: []byte("7")},
+	}}
+	r, _ := newFetchingReader(t, []kafka.Message{fetched},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithPropagator(propagation.TraceContext{}),
+		WithBaggageRules(
+			BaggageRule{Header: "x-tenant-id", Member: "tenant.id"},
+			BaggageRule{Header: "correlation.id"},
+			BaggageRule{Header: "x-user-id", Member: "user.id"},
+		),
+		WithBaggageAttributes("tenant.id", "correlation.id", "user.id"),
+	)
+
+	// When
+	msg := fetchMessage(t, r)
+	ctx, span := r.StartProcessSpan(context.Background(), &msg)
+	span.End()
+
+	// Then
+	bag := baggage.FromContext(ctx)
+	assert.Equal(t, "acme", bag.Member("tenant.id").Value())
+	assert.Equal(t, "c-1", bag.Member("correlation.id").Value())
+	assert.Equal(t, "42", bag.Member("user.id").Value())
+	if process := spansByName(sr.Ended(), "process orders"); assert.Len(t, process, 1) {
+		assert.Subset(t, process[0].Attributes(), []attribute.KeyValue{
+			attribute.String("tenant.id", "acme"),
+			attribute.String("correlation.id", "c-1"),
+			attribute.String("user.id", "42"),
+		})
+	}
+	injected := baggage.FromContext(propagation.Baggage{}.Extract(context.Background(), NewMessageCarrier(&msg)))
+	assert.Equal(t, "acme", injected.Member("tenant.id").Value())
+}
+
+func TestWriterPropagatesBaggage(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Transport:    &fakeTransport{},
+		BatchTimeout: time.Millisecond,
+	},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithPropagator(propagation.TraceContext{}),
+		WithBaggageAttributes("tenant.id"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	member, _ := baggage.NewMember("tenant.id", "acme")
+	bag, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	msgs := []kafka.Message{{Topic: "orders"}}
+
+	// When
+	err = w.WriteMessages(ctx, msgs)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant.id=acme", NewMessageCarrier(&msgs[0]).Get("baggage"))
+	if create := spansByName(sr.Ended(), "create orders"); assert.Len(t, create, 1) {
+		assert.Contains(t, create[0].Attributes(), attribute.String("tenant.id", "acme"))
+	}
+}
+
+func TestReaderWithoutBaggage(t *testing.T) {
+	// Given
+	r := newTestReader(t, WithPropagator(propagation.TraceContext{}), WithoutBaggage())
+	msg := kafka.Message{Topic: "orders", Headers: []kafka.Header{{Key: "baggage", Value: []byte("tenant.id=acme")}}}
+
+	// When
+	ctx, _ := r.StartProcessSpan(context.Background(), &msg)
+
+	// Then
+	assert.Zero(t, baggage.FromContext(ctx).Len())
+}
@@ -0,0 +1,107 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BinaryTraceContextHeader is the header holding the binary trace context
+// written by BinaryTraceContext.
+const BinaryTraceContextHeader = "traceparent-bin"
+
+// Keys of the text W3C trace-context headers.
+const (
+	textTraceParentHeader = "traceparent"
+	textTraceStateHeader  = "tracestate"
+)
+
+// binaryTraceContextVersion is the only version of the binary layout.
+const binaryTraceContextVersion = 0
+
+// binaryTraceContextLen is the length of the binary trace context: the
+// version, trace ID, span ID and trace flags.
+const binaryTraceContextLen = 1 + 16 + 8 + 1
+
+// BinaryTraceContext is a propagator writing the trace context as a single
+// fixed 26 bytes header, in the W3C binary trace-context layout, instead of
+// the roughly 100 bytes of the text traceparent and tracestate headers.
+//
+// It reads the binary header first, and falls back to the text W3C headers,
+// so consumers can switch to it before producers do.
+type BinaryTraceContext struct {
+	// TraceState also propagates the tracestate, in the text tracestate
+	// header, when it is not empty.
+	TraceState bool
+}
+
+var _ propagation.TextMapPropagator = BinaryTraceContext{}
+
+// Inject sets the binary trace context of the span context of ctx into
+// carrier.
+func (b BinaryTraceContext) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	if b.TraceState {
+		if ts := sc.TraceState().String(); ts != "" {
+			carrier.Set(textTraceStateHeader, ts)
+		}
+	}
+	carrier.Set(BinaryTraceContextHeader, string(encodeBinaryTraceContext(sc)))
+}
+
+// Extract reads the binary trace context from carrier, or the text one when
+// there is no valid binary trace context.
+func (b BinaryTraceContext) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := decodeBinaryTraceContext([]byte(carrier.Get(BinaryTraceContextHeader)))
+	if !ok {
+		return propagation.TraceContext{}.Extract(ctx, carrier)
+	}
+
+	if b.TraceState {
+		if ts, err := trace.ParseTraceState(carrier.Get(textTraceStateHeader)); err == nil {
+			sc = sc.WithTraceState(ts)
+		}
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields returns the keys BinaryTraceContext reads and writes.
+func (b BinaryTraceContext) Fields() []string {
+	return []string{BinaryTraceContextHeader, textTraceParentHeader, textTraceStateHeader}
+}
+
+// encodeBinaryTraceContext returns sc in the binary trace-context layout.
+func encodeBinaryTraceContext(sc trace.SpanContext) []byte {
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+
+	buf := make([]byte, 0, binaryTraceContextLen)
+	buf = append(buf, binaryTraceContextVersion)
+	buf = append(buf, traceID[:]...)
+	buf = append(buf, spanID[:]...)
+	return append(buf, byte(sc.TraceFlags()&trace.FlagsSampled))
+}
+
+// decodeBinaryTraceContext returns the span context buf holds in the binary
+// trace-context layout, if it is a valid one.
+func decodeBinaryTraceContext(buf []byte) (trace.SpanContext, bool) {
+	if len(buf) != binaryTraceContextLen || buf[0] != binaryTraceContextVersion {
+		return trace.SpanContext{}, false
+	}
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], buf[1:17])
+	copy(spanID[:], buf[17:25])
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.TraceFlags(buf[25]) & trace.FlagsSampled,
+		Remote:     true,
+	})
+	return sc, sc.IsValid()
+}
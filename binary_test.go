@@ -0,0 +1,77 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBinaryTraceContextInject(t *testing.T) {
+	// Given
+	sc := testSpanContext(t)
+	ts, _ := trace.ParseTraceState("vendor=value")
+	ctx := trace.ContextWithSpanContext(context.Background(), sc.WithTraceState(ts))
+	msg, withState := kafka.Message{}, kafka.Message{}
+
+	// When
+	BinaryTraceContext{}.Inject(ctx, NewMessageCarrier(&msg))
+	BinaryTraceContext{TraceState: true}.Inject(ctx, NewMessageCarrier(&withState))
+
+	// Then
+	if assert.Len(t, msg.Headers, 1) {
+		assert.Equal(t, BinaryTraceContextHeader, msg.Headers[0].Key)
+		assert.Len(t, msg.Headers[0].Value, 26)
+		assert.Equal(t, byte(0), msg.Headers[0].Value[0])
+		assert.Equal(t, sc.TraceID(), trace.TraceID(msg.Headers[0].Value[1:17]))
+		assert.Equal(t, sc.SpanID(), trace.SpanID(msg.Headers[0].Value[17:25]))
+		assert.Equal(t, byte(trace.FlagsSampled), msg.Headers[0].Value[25])
+	}
+	assert.Equal(t, "vendor=value", NewMessageCarrier(&withState).Get("tracestate"))
+}
+
+func TestBinaryTraceContextRoundTrip(t *testing.T) {
+	// Given
+	sc := testSpanContext(t)
+	ts, _ := trace.ParseTraceState("vendor=value")
+	msg := kafka.Message{}
+	p := BinaryTraceContext{TraceState: true}
+	p.Inject(trace.ContextWithSpanContext(context.Background(), sc.WithTraceState(ts)), NewMessageCarrier(&msg))
+
+	// When
+	got := trace.SpanContextFromContext(p.Extract(context.Background(), NewMessageCarrier(&msg)))
+
+	// Then
+	assert.True(t, got.Equal(sc.WithTraceState(ts).WithRemote(true)))
+}
+
+func TestBinaryTraceContextFallsBackToText(t *testing.T) {
+	// Given
+	sc := testSpanContext(t)
+	msg := kafka.Message{Headers: []kafka.Header{{Key: BinaryTraceContextHeader, Value: []byte{1, 2, 3}}}}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), NewMessageCarrier(&msg))
+
+	// When
+	got := trace.SpanContextFromContext(BinaryTraceContext{}.Extract(context.Background(), NewMessageCarrier(&msg)))
+
+	// Then
+	assert.Equal(t, sc.TraceID(), got.TraceID())
+	assert.Equal(t, sc.SpanID(), got.SpanID())
+}
+
+func TestReaderWithBinaryTraceContext(t *testing.T) {
+	// Given
+	r := newTestReader(t, WithPropagator(BinaryTraceContext{}), WithoutBaggage())
+	msg := kafka.Message{Topic: "orders"}
+	BinaryTraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), testSpanContext(t)), NewMessageCarrier(&msg))
+
+	// When
+	ctx, _ := r.StartProcessSpan(context.Background(), &msg)
+
+	// Then
+	assert.Equal(t, testTraceID, trace.SpanContextFromContext(ctx).TraceID().String())
+	assert.Len(t, msg.Headers, 1)
+}
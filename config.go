@@ -2,11 +2,15 @@ package otelkafkakonsumer
 
 import (
 	"context"
+	"time"
 
+	"github.com/segmentio/kafka-go"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
-	semconv "go.opentelemetry.io/otel/semconv/v1.13.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -22,15 +26,82 @@ type Config struct {
 
 	Tracer         trace.Tracer
 	TracerProvider trace.TracerProvider
+	Meter          metric.Meter
+	MeterProvider  metric.MeterProvider
 	Propagator     propagation.TextMapPropagator
 
 	DefaultStartOpts []trace.SpanStartOption
+
+	// AbandonedSpanTimeout is how long a fetched message span may stay open
+	// before it ends with the abandoned status. Zero uses
+	// DefaultAbandonedSpanTimeout, a negative value disables the timeout.
+	AbandonedSpanTimeout time.Duration
+
+	// LegacyAttributes makes spans carry the pre-stable messaging attributes
+	// along with the current ones, for a migration window.
+	LegacyAttributes bool
+
+	// OmitConnectionAttributes leaves the consumer group, client ID and
+	// broker address taken from the wrapped client out of spans.
+	OmitConnectionAttributes bool
+
+	// SpanNameFormatter names spans after their operation, e.g. "receive" or
+	// "publish", and the message they are about. Spans covering several
+	// messages get a message holding only the topic they share, if any.
+	SpanNameFormatter func(operation string, msg *kafka.Message) string
+
+	// MessageAttributes derives attributes from the message of a span. They
+	// are added last, so they take precedence over the other attributes.
+	MessageAttributes func(msg *kafka.Message) []attribute.KeyValue
+
+	// HeaderCapture selects the headers recorded as span attributes. A nil
+	// HeaderCapture records none.
+	HeaderCapture *HeaderCapture
+
+	// KeyPolicy decides how message keys are recorded on spans.
+	KeyPolicy KeyPolicy
+
+	// MessageSampler decides whether the span of a message is sampled. A nil
+	// MessageSampler leaves every decision to the TracerProvider.
+	MessageSampler MessageSampler
+
+	// OmitBaggage stops the W3C baggage from being propagated through the
+	// message headers along with the Propagator.
+	OmitBaggage bool
+
+	// BaggageRules promote plain headers of consumed messages to baggage
+	// members.
+	BaggageRules []BaggageRule
+
+	// BaggageAttributes lists the baggage members recorded as attributes of
+	// the message spans.
+	BaggageAttributes []string
+
+	// TopicFilter decides which topics are traced. A nil TopicFilter traces
+	// every topic.
+	TopicFilter TopicFilter
+
+	// ConsumerSpanRelation is how the receive, process and commit spans of a
+	// Reader relate to the context they continue. The zero value makes them
+	// children of it.
+	ConsumerSpanRelation ConsumerSpanRelation
+
+	// RetryPolicy configures how Reader.HandleMessage retries a failed
+	// handler. The zero value does not retry.
+	RetryPolicy RetryPolicy
+
+	// DeadLetterWriter writes the messages whose handling finally failed to
+	// DeadLetterTopic. A nil DeadLetterWriter disables the dead-letter queue.
+	DeadLetterWriter *Writer
+	DeadLetterTopic  string
 }
 
 // NewConfig returns a Config for instrumentation with all options applied.
 //
-// If no TracerProvider or Propagator are specified with options, the default
-// OpenTelemetry globals will be used.
+// If no TracerProvider, MeterProvider or Propagator are specified with options,
+// the default OpenTelemetry globals will be used. The Propagator is composed
+// with the W3C baggage propagator, unless it already propagates baggage or
+// the WithoutBaggage option is set.
 func NewConfig(instrumentationName string, options ...Option) *Config {
 	c := Config{defaultTracerName: instrumentationName}
 
@@ -40,18 +111,50 @@ func NewConfig(instrumentationName string, options ...Option) *Config {
 		}
 	}
 
+	if c.TracerProvider == nil {
+		c.TracerProvider = otel.GetTracerProvider()
+	}
+
 	if c.Tracer == nil {
-		c.Tracer = otel.Tracer(
+		c.Tracer = c.TracerProvider.Tracer(
 			c.defaultTracerName,
 			trace.WithInstrumentationVersion(version),
 			trace.WithSchemaURL(semconv.SchemaURL),
 		)
 	}
 
+	if c.MeterProvider == nil {
+		c.MeterProvider = otel.GetMeterProvider()
+	}
+
+	if c.Meter == nil {
+		c.Meter = c.MeterProvider.Meter(
+			c.defaultTracerName,
+			metric.WithInstrumentationVersion(version),
+			metric.WithSchemaURL(semconv.SchemaURL),
+		)
+	}
+
 	if c.Propagator == nil {
 		c.Propagator = otel.GetTextMapPropagator()
 	}
 
+	if !c.OmitBaggage {
+		c.Propagator = withBaggage(c.Propagator)
+	}
+
+	if c.SpanNameFormatter == nil {
+		c.SpanNameFormatter = DefaultSpanNameFormatter
+	}
+
+	if c.AbandonedSpanTimeout == 0 {
+		c.AbandonedSpanTimeout = DefaultAbandonedSpanTimeout
+	}
+
+	if c.KeyPolicy == nil {
+		c.KeyPolicy = DefaultKeyPolicy
+	}
+
 	return &c
 }
 
@@ -90,6 +193,15 @@ func (c *Config) MergedSpanStartOptions(opts ...trace.SpanStartOption) []trace.S
 	return merged
 }
 
+// derivedAttributes returns the attributes the MessageAttributes hook derives
+// from msg, if c is configured with one.
+func (c *Config) derivedAttributes(msg *kafka.Message) []attribute.KeyValue {
+	if c.MessageAttributes == nil {
+		return nil
+	}
+	return c.MessageAttributes(msg)
+}
+
 // WithSpan wraps the function f with a span named name.
 func (c *Config) WithSpan(ctx context.Context, name string, f func(context.Context) error, opts ...trace.SpanStartOption) error {
 	sso := c.MergedSpanStartOptions(opts...)
@@ -0,0 +1,106 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// countGlobalTracers replaces the global TracerProvider, until the end of t,
+// with one that counts how many tracers are requested from it in the returned
+// counter.
+func countGlobalTracers(t *testing.T) *atomic.Int64 {
+	t.Helper()
+
+	calls := &atomic.Int64{}
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(&fnTracerProvider{
+		tracer: func(name string, _ ...trace.TracerOption) trace.Tracer {
+			calls.Add(1)
+			return trace.NewNoopTracerProvider().Tracer(name)
+		},
+	})
+	// The first provider set gets the tracers already requested from the
+	// default one, which are not counted.
+	calls.Store(0)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return calls
+}
+
+func TestNewConfigUsesTracerProvider(t *testing.T) {
+	// Given
+	calls := countGlobalTracers(t)
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	// When
+	c := NewConfig(instrumentationName, WithTracerProvider(tp))
+	_, span := c.Tracer.Start(context.Background(), "span")
+	span.End()
+
+	// Then
+	assert.Zero(t, calls.Load())
+	assert.Equal(t, tp, c.TracerProvider)
+	spans := sr.Ended()
+	if assert.Len(t, spans, 1) {
+		scope := spans[0].InstrumentationScope()
+		assert.Equal(t, instrumentationName, scope.Name)
+		assert.Equal(t, version, scope.Version)
+		assert.Equal(t, semconv.SchemaURL, scope.SchemaURL)
+	}
+}
+
+func TestNewConfigIsolatesTracerProviders(t *testing.T) {
+	// Given
+	calls := countGlobalTracers(t)
+	sr1, sr2 := tracetest.NewSpanRecorder(), tracetest.NewSpanRecorder()
+	tp1 := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr1))
+	tp2 := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr2))
+
+	// When
+	c1 := NewConfig(instrumentationName, WithTracerProvider(tp1))
+	c2 := NewConfig(instrumentationName, WithTracerProvider(tp2))
+	_, span := c1.Tracer.Start(context.Background(), "first")
+	span.End()
+	_, span = c2.Tracer.Start(context.Background(), "second")
+	span.End()
+
+	// Then
+	assert.Zero(t, calls.Load())
+	if assert.Len(t, sr1.Ended(), 1) {
+		assert.Equal(t, "first", sr1.Ended()[0].Name())
+	}
+	if assert.Len(t, sr2.Ended(), 1) {
+		assert.Equal(t, "second", sr2.Ended()[0].Name())
+	}
+}
+
+func TestNewConfigDefaultsToGlobalTracerProvider(t *testing.T) {
+	// Given
+	calls := countGlobalTracers(t)
+
+	// When
+	NewConfig(instrumentationName)
+
+	// Then
+	assert.Equal(t, int64(1), calls.Load())
+}
+
+func TestNewConfigDefaultsAbandonedSpanTimeout(t *testing.T) {
+	// Given
+	// When
+	defaulted := NewConfig(instrumentationName)
+	disabled := NewConfig(instrumentationName, WithAbandonedSpanTimeout(-1))
+
+	// Then
+	assert.Equal(t, DefaultAbandonedSpanTimeout, defaulted.AbandonedSpanTimeout)
+	assert.Equal(t, time.Duration(-1), disabled.AbandonedSpanTimeout)
+}
@@ -0,0 +1,116 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errClosedBeforeDelivery is recorded on the spans of asynchronous writes
+// whose delivery was not reported before the Writer was closed.
+var errClosedBeforeDelivery = errors.New("otelkafkakonsumer: writer closed before the message delivery was reported")
+
+// delivery is the producer span of a message written but not yet reported
+// delivered.
+type delivery struct {
+	span trace.Span
+	msg  kafka.Message
+	// async is true when the span is ended by the delivery report rather
+	// than by the call writing the message.
+	async bool
+}
+
+// deliveryTracker holds the producer spans of messages handed to a
+// kafka.Writer until the writer reports their delivery through its
+// Completion callback. It is safe for concurrent use.
+//
+// Reported messages are matched to their span through the span context
+// injected into their headers, so messages whose span context cannot be
+// extracted back are not tracked.
+type deliveryTracker struct {
+	cfg *Config
+
+	mu         sync.Mutex
+	deliveries map[trace.SpanID]*delivery
+}
+
+func newDeliveryTracker(cfg *Config) *deliveryTracker {
+	return &deliveryTracker{cfg: cfg, deliveries: make(map[trace.SpanID]*delivery)}
+}
+
+// spanID returns the ID of the span context injected into msg.
+func (d *deliveryTracker) spanID(msg *kafka.Message) trace.SpanID {
+	ctx := d.cfg.Propagator.Extract(context.Background(), NewMessageCarrier(msg))
+	return trace.SpanContextFromContext(ctx).SpanID()
+}
+
+// track holds span, the producer span of msg, until msg is reported
+// delivered or untrack is called. It reports whether span is tracked.
+func (d *deliveryTracker) track(msg *kafka.Message, span trace.Span, async bool) bool {
+	id := span.SpanContext().SpanID()
+	if !span.IsRecording() || d.spanID(msg) != id {
+		return false
+	}
+
+	d.mu.Lock()
+	d.deliveries[id] = &delivery{span: span, msg: *msg, async: async}
+	d.mu.Unlock()
+	return true
+}
+
+// untrack stops holding span. It reports whether span was still held, that
+// is whether it was not ended by a delivery report.
+func (d *deliveryTracker) untrack(span trace.Span) bool {
+	id := span.SpanContext().SpanID()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.deliveries[id]
+	delete(d.deliveries, id)
+	return ok
+}
+
+// completion is chained onto kafka.Writer.Completion. It sets the partition
+// and offset Kafka assigned to every delivered message on its span, and ends
+// the spans of asynchronous writes with the delivery outcome.
+func (d *deliveryTracker) completion(msgs []kafka.Message, err error) {
+	for i := range msgs {
+		id := d.spanID(&msgs[i])
+
+		d.mu.Lock()
+		entry, ok := d.deliveries[id]
+		if ok && entry.async {
+			delete(d.deliveries, id)
+		}
+		d.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+		if err == nil {
+			entry.span.SetAttributes(d.cfg.positionAttributes(&msgs[i])...)
+		}
+		if entry.async {
+			endSpan(entry.span, err)
+		}
+	}
+}
+
+// flush ends the spans of asynchronous writes that are still waiting for
+// their delivery report, and stops holding every span.
+func (d *deliveryTracker) flush() {
+	d.mu.Lock()
+	deliveries := d.deliveries
+	d.deliveries = make(map[trace.SpanID]*delivery)
+	d.mu.Unlock()
+
+	for _, entry := range deliveries {
+		if entry.async {
+			endSpan(entry.span, errClosedBeforeDelivery)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDeliveryTrackerFlushEndsAsyncSpans(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	cfg := NewConfig(instrumentationName,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithPropagator(propagation.TraceContext{}),
+	)
+	d := newDeliveryTracker(cfg)
+	async, sync := &kafka.Message{Topic: "orders"}, &kafka.Message{Topic: "orders"}
+	ctx, asyncSpan := cfg.Tracer.Start(context.Background(), "async")
+	cfg.Propagator.Inject(ctx, NewMessageCarrier(async))
+	ctx, syncSpan := cfg.Tracer.Start(context.Background(), "sync")
+	cfg.Propagator.Inject(ctx, NewMessageCarrier(sync))
+	assert.True(t, d.track(async, asyncSpan, true))
+	assert.True(t, d.track(sync, syncSpan, false))
+
+	// When
+	d.flush()
+
+	// Then
+	if assert.Len(t, sr.Ended(), 1) {
+		assert.Equal(t, "async", sr.Ended()[0].Name())
+		assert.Equal(t, codes.Error, sr.Ended()[0].Status().Code)
+	}
+	assert.False(t, d.untrack(syncSpan))
+}
+
+func TestDeliveryTrackerIgnoresMessagesWithoutSpanContext(t *testing.T) {
+	// Given
+	cfg := NewConfig(instrumentationName, WithPropagator(propagation.TraceContext{}))
+	d := newDeliveryTracker(cfg)
+	_, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "span")
+
+	// When
+	tracked := d.track(&kafka.Message{Topic: "orders"}, span, true)
+
+	// Then
+	assert.False(t, tracked)
+}
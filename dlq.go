@@ -0,0 +1,85 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers added to the messages written to the dead-letter queue.
+const (
+	DeadLetterExceptionTypeHeader    = "x-dlq-exception-type"
+	DeadLetterExceptionMessageHeader = "x-dlq-exception-message"
+	DeadLetterTopicHeader            = "x-dlq-original-topic"
+	DeadLetterPartitionHeader        = "x-dlq-original-partition"
+	DeadLetterOffsetHeader           = "x-dlq-original-offset"
+	DeadLetterTimestampHeader        = "x-dlq-timestamp"
+)
+
+// ErrNoDeadLetterQueue is returned by Reader.DeadLetter when the reader was
+// created without the WithDeadLetterQueue option.
+var ErrNoDeadLetterQueue = errors.New("otelkafkakonsumer: no dead-letter queue configured")
+
+// ErrNoDeadLetterCause is returned by Reader.DeadLetter when it is called
+// with a nil cause.
+var ErrNoDeadLetterCause = errors.New("otelkafkakonsumer: no dead-letter cause given")
+
+// DeadLetter writes msg to the dead-letter queue set with the
+// WithDeadLetterQueue option, because handling it failed with cause.
+//
+// The written message keeps the key, value and headers of msg, and carries
+// the cause and the original position of msg in the DeadLetter headers. Its
+// producer span links to the span held by ctx and to the span owned by msg.
+// DeadLetter does not commit msg, and fails with ErrNoDeadLetterCause when
+// cause is nil.
+func (r *Reader) DeadLetter(ctx context.Context, msg kafka.Message, cause error) error {
+	return r.deadLetter(ctx, msg, cause, trace.SpanContextFromContext(ctx))
+}
+
+// deadLetter implements DeadLetter, linking the producer span to failed.
+func (r *Reader) deadLetter(ctx context.Context, msg kafka.Message, cause error, failed trace.SpanContext) error {
+	w := r.TraceConfig.DeadLetterWriter
+	if w == nil {
+		return ErrNoDeadLetterQueue
+	}
+	if cause == nil {
+		return ErrNoDeadLetterCause
+	}
+
+	var links []trace.Link
+	for _, sc := range []trace.SpanContext{failed, r.MessageSpan(msg).SpanContext()} {
+		if sc.IsValid() && (len(links) == 0 || !links[0].SpanContext.Equal(sc)) {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	dlqMsg := deadLetterMessage(r.TraceConfig.DeadLetterTopic, msg, cause, time.Now())
+	return w.writeMessage(ctx, dlqMsg, trace.WithLinks(links...))
+}
+
+// deadLetterMessage returns the message written to topic when handling msg
+// failed with cause at now.
+func deadLetterMessage(topic string, msg kafka.Message, cause error, now time.Time) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+6)
+	headers = append(headers, msg.Headers...)
+	dlqMsg := kafka.Message{
+		Topic:   topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+
+	carrier := NewMessageCarrier(&dlqMsg)
+	carrier.Set(DeadLetterExceptionTypeHeader, fmt.Sprintf("%T", cause))
+	carrier.Set(DeadLetterExceptionMessageHeader, cause.Error())
+	carrier.Set(DeadLetterTopicHeader, msg.Topic)
+	carrier.Set(DeadLetterPartitionHeader, strconv.Itoa(msg.Partition))
+	carrier.Set(DeadLetterOffsetHeader, strconv.FormatInt(msg.Offset, 10))
+	carrier.Set(DeadLetterTimestampHeader, now.UTC().Format(time.RFC3339Nano))
+	return dlqMsg
+}
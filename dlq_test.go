@@ -0,0 +1,178 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDeadLetterMessage(t *testing.T) {
+	// Given
+	msg := kafka.Message{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("key"),
+		Value:     []byte("value"),
+		Headers:   []kafka.Header{{Key: "tenant", Value: []byte("acme")}},
+	}
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// When
+	got := deadLetterMessage("orders.dlq", msg, errors.New("boom"), now)
+
+	// Then
+	assert.Equal(t, "orders.dlq", got.Topic)
+	assert.Equal(t, msg.Key, got.Key)
+	assert.Equal(t, msg.Value, got.Value)
+	assert.Equal(t, []kafka.Header{
+		{Key: "tenant", Value: []byte("acme")},
+		{Key: DeadLetterExceptionTypeHeader, Value: []byte("*errors.errorString")},
+		{Key: DeadLetterExceptionMessageHeader, Value: []byte("boom")},
+		{Key: DeadLetterTopicHeader, Value: []byte("orders")},
+		{Key: DeadLetterPartitionHeader, Value: []byte("3")},
+		{Key: DeadLetterOffsetHeader, Value: []byte("42")},
+		{Key: DeadLetterTimestampHeader, Value: []byte("2023-10-01T12:00:00Z")},
+	}, got.Headers)
+	assert.Len(t, msg.Headers, 1)
+}
+
+func TestReaderDeadLetterLinksFailedSpan(t *testing.T) {
+	// Given
+	w, wsr := newTestWriter(t, &fakeTransport{})
+	rsr := tracetest.NewSpanRecorder()
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rsr))),
+		WithDeadLetterQueue(w, "orders.dlq"),
+	)
+	msg := kafka.Message{Topic: "orders", Offset: 7}
+	ctx, failed := r.startSpan(operationProcess, &msg)
+	failed.End()
+
+	// When
+	err := r.DeadLetter(ctx, msg, errors.New("boom"))
+
+	// Then
+	assert.NoError(t, err)
+	if spans := spansByName(wsr.Ended(), "publish orders.dlq"); assert.Len(t, spans, 1) {
+		if links := spans[0].Links(); assert.Len(t, links, 1) {
+			assert.Equal(t, trace.SpanContextFromContext(ctx), links[0].SpanContext)
+		}
+	}
+}
+
+func TestReaderDeadLetterWithoutQueue(t *testing.T) {
+	// Given
+	r := newTestReader(t)
+
+	// When
+	err := r.DeadLetter(context.Background(), kafka.Message{Topic: "orders"}, errors.New("boom"))
+
+	// Then
+	assert.ErrorIs(t, err, ErrNoDeadLetterQueue)
+}
+
+func TestReaderDeadLetterWithoutCause(t *testing.T) {
+	// Given
+	w, wsr := newTestWriter(t, &fakeTransport{})
+	r := newTestReader(t, WithDeadLetterQueue(w, "orders.dlq"))
+
+	// When
+	err := r.DeadLetter(context.Background(), kafka.Message{Topic: "orders"}, nil)
+
+	// Then
+	assert.ErrorIs(t, err, ErrNoDeadLetterCause)
+	assert.Empty(t, wsr.Ended())
+}
+
+func TestReaderConsumeDeadLettersHandledMessage(t *testing.T) {
+	// Given
+	delivered := make(chan kafka.Message, 1)
+	w, _ := newTestWriter(t, &fakeTransport{}, func(kw *kafka.Writer) {
+		kw.Completion = func(messages []kafka.Message, _ error) {
+			for _, m := range messages {
+				delivered <- m
+			}
+		}
+	})
+	r, _ := newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 7}},
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+		WithDeadLetterQueue(w, "orders.dlq"),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+
+	// When
+	go func() {
+		done <- r.Consume(ctx, func(context.Context, kafka.Message) error { return errors.New("boom") })
+	}()
+
+	// Then
+	select {
+	case msg := <-delivered:
+		assert.Equal(t, "orders.dlq", msg.Topic)
+		assert.Equal(t, "1", NewMessageCarrier(&msg).Get(RetryCountHeader))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not dead-lettered")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestReaderConsumeCommitsAfterDeadLetter(t *testing.T) {
+	// Given
+	// committedAtDelivery is guarded by source.mu.
+	committedAtDelivery := -1
+	var source *fakeSource
+	w, wsr := newTestWriter(t, &fakeTransport{}, func(kw *kafka.Writer) {
+		kw.Completion = func([]kafka.Message, error) {
+			source.mu.Lock()
+			defer source.mu.Unlock()
+			committedAtDelivery = len(source.committed)
+		}
+	})
+	var r *Reader
+	r, source = newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 7}},
+		WithDeadLetterQueue(w, "orders.dlq"),
+	)
+
+	// When
+	err := consume(t, r, source, func(context.Context, kafka.Message) error { return errors.New("boom") })
+
+	// Then
+	assert.NoError(t, err)
+	assert.Len(t, spansByName(wsr.Ended(), "publish orders.dlq"), 1)
+	source.mu.Lock()
+	assert.Zero(t, committedAtDelivery)
+	source.mu.Unlock()
+	assert.Equal(t, []kafka.Message{{Topic: "orders", Offset: 7}}, source.committed)
+}
+
+func TestReaderConsumeSkipsCommitWhenDeadLetterFails(t *testing.T) {
+	// Given
+	w, _ := newTestWriter(t, &fakeTransport{errors: map[string]kafka.Error{"orders.dlq": kafka.MessageSizeTooLarge}})
+	sr := tracetest.NewSpanRecorder()
+	r, source := newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 7}},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithDeadLetterQueue(w, "orders.dlq"),
+	)
+
+	// When
+	err := consume(t, r, source, func(context.Context, kafka.Message) error { return errors.New("boom") })
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, source.committed)
+	if process := spansByName(sr.Ended(), "process orders"); assert.Len(t, process, 1) {
+		assert.Equal(t, codes.Error, process[0].Status().Code)
+	}
+}
@@ -29,12 +29,6 @@ func main() {
 		}),
 		otelkafkakonsumer.WithTracerProvider(tp),
 		otelkafkakonsumer.WithPropagator(propagation.TraceContext{}),
-		otelkafkakonsumer.WithAttributes(
-			[]attribute.KeyValue{
-				semconv.MessagingDestinationKindTopic,
-				semconv.MessagingKafkaClientIDKey.String("opentel-autocommit-cg"),
-			},
-		),
 	)
 
 	for {
@@ -42,8 +36,8 @@ func main() {
 		message, _ := reader.ReadMessage(context.Background())
 		fmt.Println("incoming message", message)
 
-		// Extract tracing info from message
-		ctx := reader.TraceConfig.Propagator.Extract(context.Background(), otelkafkakonsumer.NewMessageCarrier(message))
+		// Start the process span of the message, continuing its producer context
+		ctx, processSpan := reader.StartProcessSpan(context.Background(), message)
 
 		tr := otel.Tracer("consumer")
 		parentCtx, span := tr.Start(ctx, "work")
@@ -53,6 +47,8 @@ func main() {
 		_, span = tr.Start(parentCtx, "another work")
 		time.Sleep(50 * time.Millisecond) // simulate some work
 		span.End()
+
+		processSpan.End()
 	}
 }
 
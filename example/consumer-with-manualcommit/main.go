@@ -29,12 +29,6 @@ func main() {
 		}),
 		otelkafkakonsumer.WithTracerProvider(tp),
 		otelkafkakonsumer.WithPropagator(propagation.TraceContext{}),
-		otelkafkakonsumer.WithAttributes(
-			[]attribute.KeyValue{
-				semconv.MessagingDestinationKindTopic,
-				semconv.MessagingKafkaClientIDKey.String("opentel-manualcommit-cg"),
-			},
-		),
 	)
 
 	for {
@@ -43,8 +37,8 @@ func main() {
 		reader.FetchMessage(context.Background(), m)
 		fmt.Println("incoming message", *m)
 
-		// Extract tracing info from message
-		ctx := reader.TraceConfig.Propagator.Extract(context.Background(), otelkafkakonsumer.NewMessageCarrier(m))
+		// Start the process span of the message, it ends on commit
+		ctx, _ := reader.StartProcessSpan(context.Background(), m)
 
 		tr := otel.Tracer("consumer")
 		parentCtx, span := tr.Start(ctx, "work")
@@ -55,8 +49,8 @@ func main() {
 		time.Sleep(50 * time.Millisecond) // simulate some work
 		span.End()
 
-		// Commit message
-		reader.CommitMessages(context.Background(), *m)
+		// Commit message, the commit span is a child of the process span
+		reader.CommitMessages(ctx, *m)
 	}
 }
 
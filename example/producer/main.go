@@ -54,12 +54,7 @@ func main() {
 	writer, err := otelkafkakonsumer.NewWriter(segmentioProducer,
 		otelkafkakonsumer.WithTracerProvider(tp),
 		otelkafkakonsumer.WithPropagator(propagation.TraceContext{}),
-		otelkafkakonsumer.WithAttributes(
-			[]attribute.KeyValue{
-				semconv.MessagingDestinationKindTopic,
-				semconv.MessagingKafkaClientIDKey.String("opentel-cg"),
-			},
-		))
+	)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -0,0 +1,36 @@
+// Package forcesampler provides the OpenTelemetry SDK sampler honoring the
+// otelkafkakonsumer.SamplingForce decisions of a MessageSampler.
+//
+// It is kept apart so that the otelkafkakonsumer package only depends on
+// the OpenTelemetry API.
+package forcesampler
+
+import (
+	otelkafkakonsumer "github.com/Trendyol/otel-kafka-konsumer"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a sampler sampling the spans a MessageSampler forces to be
+// sampled, and leaving the other ones to base.
+func New(base sdktrace.Sampler) sdktrace.Sampler {
+	return sampler{base: base}
+}
+
+type sampler struct {
+	base sdktrace.Sampler
+}
+
+func (s sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if otelkafkakonsumer.SamplingForced(p.ParentContext) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s sampler) Description() string {
+	return "ForceSampler{" + s.base.Description() + "}"
+}
@@ -0,0 +1,47 @@
+package forcesampler
+
+import (
+	"context"
+	"testing"
+
+	otelkafkakonsumer "github.com/Trendyol/otel-kafka-konsumer"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewSamplesForcedSpans(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithSampler(New(sdktrace.NeverSample())))
+	r, err := otelkafkakonsumer.NewReader(kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "orders",
+	}),
+		otelkafkakonsumer.WithTracerProvider(tp),
+		otelkafkakonsumer.WithMessageSampler(func(_ string, msg *kafka.Message) otelkafkakonsumer.SamplingDecision {
+			if msg.Topic == "payments" {
+				return otelkafkakonsumer.SamplingForce
+			}
+			return otelkafkakonsumer.SamplingDefault
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// When
+	_, forced := r.StartProcessSpan(context.Background(), &kafka.Message{Topic: "payments"})
+	forced.End()
+	_, unsampled := r.StartProcessSpan(context.Background(), &kafka.Message{Topic: "orders"})
+	unsampled.End()
+
+	// Then
+	if assert.Len(t, sr.Ended(), 1) {
+		assert.Equal(t, "process payments", sr.Ended()[0].Name())
+		assert.True(t, sr.Ended()[0].SpanContext().IsSampled())
+	}
+	assert.Equal(t, "ForceSampler{AlwaysOffSampler}", New(sdktrace.NeverSample()).Description())
+}
@@ -0,0 +1,157 @@
+package otelkafkakonsumer
+
+import (
+	"encoding/base64"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// headerAttributePrefix prefixes the key of the header captured by a span
+// attribute.
+const headerAttributePrefix = "messaging.kafka.header."
+
+// traceHeaders are the lower-case keys of well-known trace propagation
+// headers, which are never captured whatever the Propagator in use.
+var traceHeaders = []string{
+	"traceparent", "tracestate", "traceparent-bin", "grpc-trace-bin", "baggage",
+	"b3", "uber-trace-id", "x-amzn-trace-id", "x-cloud-trace-context",
+	"elastic-apm-traceparent", "sw8",
+}
+
+// traceHeaderPrefixes are the lower-case prefixes of the keys of well-known
+// trace propagation headers, e.g. x-b3-traceid.
+var traceHeaderPrefixes = []string{"x-b3-", "uberctx-", "ot-tracer-", "ot-baggage-", "x-datadog-"}
+
+// isTraceHeader reports whether key is that of a well-known trace propagation
+// header, whatever its case.
+func isTraceHeader(key string) bool {
+	key = strings.ToLower(key)
+	return slices.Contains(traceHeaders, key) || slices.ContainsFunc(traceHeaderPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// HeaderMatcher reports whether a header key matches.
+type HeaderMatcher func(key string) bool
+
+// HeaderGlob returns a HeaderMatcher matching the keys that match the shell
+// pattern, with the syntax of path.Match.
+func HeaderGlob(pattern string) HeaderMatcher {
+	return func(key string) bool {
+		ok, _ := path.Match(pattern, key)
+		return ok
+	}
+}
+
+// HeaderRegexp returns a HeaderMatcher matching the keys that re matches.
+func HeaderRegexp(re *regexp.Regexp) HeaderMatcher {
+	return re.MatchString
+}
+
+// HeaderEncoding is how header values that are not valid UTF-8 are recorded.
+type HeaderEncoding int
+
+const (
+	// HeaderEncodingUTF8 replaces every run of invalid bytes of a value with
+	// the Unicode replacement character.
+	HeaderEncodingUTF8 HeaderEncoding = iota
+	// HeaderEncodingBase64 records the whole value in standard base64.
+	HeaderEncodingBase64
+)
+
+// HeaderCapture selects the Kafka headers recorded as span attributes named
+// messaging.kafka.header.<key>. The headers used for propagation, and the
+// well-known trace headers such as traceparent, b3 or uber-trace-id, are never
+// captured.
+type HeaderCapture struct {
+	// Allow lists the headers to capture. An empty Allow captures every
+	// header not denied.
+	Allow []HeaderMatcher
+	// Deny lists the headers never to capture, even if allowed.
+	Deny []HeaderMatcher
+	// MaxValueLength caps the length in bytes of the recorded values. Zero
+	// means no cap.
+	MaxValueLength int
+	// Encoding is how values that are not valid UTF-8 are recorded.
+	Encoding HeaderEncoding
+}
+
+// captures reports whether the header key is captured.
+func (h *HeaderCapture) captures(key string) bool {
+	for _, deny := range h.Deny {
+		if deny(key) {
+			return false
+		}
+	}
+	if len(h.Allow) == 0 {
+		return true
+	}
+	for _, allow := range h.Allow {
+		if allow(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns how the header value v is recorded.
+func (h *HeaderCapture) value(v string) string {
+	if !utf8.ValidString(v) {
+		switch h.Encoding {
+		case HeaderEncodingBase64:
+			v = base64.StdEncoding.EncodeToString([]byte(v))
+		default:
+			v = strings.ToValidUTF8(v, string(utf8.RuneError))
+		}
+	}
+	if h.MaxValueLength > 0 && len(v) > h.MaxValueLength {
+		v = truncateUTF8(v, h.MaxValueLength)
+	}
+	return v
+}
+
+// headerAttributes returns the attributes of the headers of msg captured by
+// c's HeaderCapture, leaving out the fields of its Propagator and the
+// well-known trace headers whatever their case, e.g. X-B3-TraceId.
+func (c *Config) headerAttributes(msg *kafka.Message) []attribute.KeyValue {
+	if c.HeaderCapture == nil || len(msg.Headers) == 0 {
+		return nil
+	}
+
+	fields := c.Propagator.Fields()
+	propagated := func(key string) bool {
+		return slices.ContainsFunc(fields, func(field string) bool {
+			return strings.EqualFold(field, key)
+		})
+	}
+
+	var attrs []attribute.KeyValue
+	seen := make(map[string]struct{}, len(msg.Headers))
+	carrier := NewMessageCarrier(msg)
+	for _, key := range carrier.Keys() {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if propagated(key) || isTraceHeader(key) || !c.HeaderCapture.captures(key) {
+			continue
+		}
+		attrs = append(attrs, attribute.String(headerAttributePrefix+key, c.HeaderCapture.value(carrier.Get(key))))
+	}
+	return attrs
+}
+
+// truncateUTF8 returns the longest prefix of s that is at most n bytes long
+// and does not split a rune.
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,94 @@
+package otelkafkakonsumer
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestConfigHeaderAttributes(t *testing.T) {
+	// Given
+	cfg := NewConfig(instrumentationName,
+		WithPropagator(propagation.TraceContext{}),
+		WithHeaderCapture(HeaderCapture{
+			Allow: []HeaderMatcher{HeaderGlob("x-*"), HeaderRegexp(regexp.MustCompile(`^tenant$`)), HeaderGlob("traceparent")},
+			Deny:  []HeaderMatcher{HeaderGlob("x-secret-*")},
+		}),
+	)
+	msg := &kafka.Message{Headers: []kafka.Header{
+		{Key: "x-event-type", Value: []byte("created")},
+		{Key: "tenant", Value: []byte("acme")},
+		{Key: "x-secret-token", Value: []byte("hunter2")},
+		{Key: "other", Value: []byte("ignored")},
+		{Key: "traceparent", Value: []byte("00-0102-01")},
+	}}
+
+	// When
+	attrs := cfg.headerAttributes(msg)
+
+	// Then
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("messaging.kafka.header.x-event-type", "created"),
+		attribute.String("messaging.kafka.header.tenant", "acme"),
+	}, attrs)
+}
+
+func TestConfigHeaderAttributesSkipsPropagationFieldsWhateverTheirCase(t *testing.T) {
+	// Given
+	cfg := NewConfig(instrumentationName,
+		WithPropagator(B3Propagator()),
+		WithHeaderCapture(HeaderCapture{}),
+	)
+	msg := &kafka.Message{Headers: []kafka.Header{
+		{Key: "X-B3-TraceId", Value: []byte("0102")},
+		{Key: "X-B3-SpanId", Value: []byte("0304")},
+		{Key: "x-event-type", Value: []byte("created")},
+	}}
+
+	// When
+	attrs := cfg.headerAttributes(msg)
+
+	// Then
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("messaging.kafka.header.x-event-type", "created"),
+	}, attrs)
+}
+
+func TestConfigHeaderAttributesSkipsWellKnownTraceHeaders(t *testing.T) {
+	// Given
+	cfg := NewConfig(instrumentationName,
+		WithPropagator(propagation.TraceContext{}),
+		WithHeaderCapture(HeaderCapture{}),
+	)
+	msg := &kafka.Message{Headers: []kafka.Header{
+		{Key: "X-B3-TraceId", Value: []byte("0102")},
+		{Key: "b3", Value: []byte("0102-0304-1")},
+		{Key: "uber-trace-id", Value: []byte("0102:0304:0:1")},
+		{Key: "uberctx-tenant", Value: []byte("acme")},
+		{Key: "traceparent-bin", Value: []byte{0x00}},
+		{Key: "Baggage", Value: []byte("tenant=acme")},
+		{Key: "x-event-type", Value: []byte("created")},
+	}}
+
+	// When
+	attrs := cfg.headerAttributes(msg)
+
+	// Then
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("messaging.kafka.header.x-event-type", "created"),
+	}, attrs)
+}
+
+func TestHeaderCaptureValue(t *testing.T) {
+	binary := string([]byte{0xff, 0xfe, 'a'})
+
+	assert.Equal(t, "�a", (&HeaderCapture{}).value(binary))
+	assert.Equal(t, "//5h", (&HeaderCapture{Encoding: HeaderEncodingBase64}).value(binary))
+	assert.Equal(t, "plain", (&HeaderCapture{Encoding: HeaderEncodingBase64}).value("plain"))
+	assert.Equal(t, "ab", (&HeaderCapture{MaxValueLength: 3}).value("abé"))
+	assert.Equal(t, "abc", (&HeaderCapture{MaxValueLength: 3}).value("abcdef"))
+}
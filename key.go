@@ -0,0 +1,68 @@
+package otelkafkakonsumer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyPolicy returns the value recorded as the messaging.kafka.message.key
+// attribute of a span for a message key, or false to leave the attribute
+// out. Keys may hold personal data or binary encodings, so the policy decides
+// what is safe to record.
+type KeyPolicy func(key []byte) (value string, ok bool)
+
+// DefaultKeyPolicy records keys as they are, unless they are not valid
+// UTF-8, like binary Avro or protobuf keys, in which case they are left out.
+func DefaultKeyPolicy(key []byte) (string, bool) {
+	if len(key) == 0 || !utf8.Valid(key) {
+		return "", false
+	}
+	return string(key), true
+}
+
+// OmitKey is a KeyPolicy never recording keys.
+func OmitKey([]byte) (string, bool) {
+	return "", false
+}
+
+// RawKey is a KeyPolicy recording keys as they are, even when they are not
+// valid UTF-8.
+func RawKey(key []byte) (string, bool) {
+	if len(key) == 0 {
+		return "", false
+	}
+	return string(key), true
+}
+
+// HashedKey returns a KeyPolicy recording the hex encoded SHA-256 hash of
+// salt followed by the key. It lets spans of the same key be correlated
+// without revealing it.
+func HashedKey(salt []byte) KeyPolicy {
+	return func(key []byte) (string, bool) {
+		if len(key) == 0 {
+			return "", false
+		}
+		h := sha256.New()
+		h.Write(salt)
+		h.Write(key)
+		return hex.EncodeToString(h.Sum(nil)), true
+	}
+}
+
+// TruncatedKey returns a KeyPolicy recording at most the first n bytes of
+// keys, with the invalid UTF-8 bytes replaced with the Unicode replacement
+// character.
+func TruncatedKey(n int) KeyPolicy {
+	return func(key []byte) (string, bool) {
+		if len(key) == 0 || n <= 0 {
+			return "", false
+		}
+		v := strings.ToValidUTF8(string(key), string(utf8.RuneError))
+		if len(v) > n {
+			v = truncateUTF8(v, n)
+		}
+		return v, true
+	}
+}
@@ -0,0 +1,56 @@
+package otelkafkakonsumer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+func TestKeyPolicies(t *testing.T) {
+	binary := []byte{0xff, 'a', 'b'}
+	salted := sha256.Sum256([]byte("saltkey"))
+
+	tests := []struct {
+		name   string
+		policy KeyPolicy
+		key    []byte
+		value  string
+		ok     bool
+	}{
+		{"default", DefaultKeyPolicy, []byte("key"), "key", true},
+		{"default binary", DefaultKeyPolicy, binary, "", false},
+		{"default empty", DefaultKeyPolicy, nil, "", false},
+		{"omit", OmitKey, []byte("key"), "", false},
+		{"raw binary", RawKey, binary, string(binary), true},
+		{"hashed", HashedKey([]byte("salt")), []byte("key"), hex.EncodeToString(salted[:]), true},
+		{"truncated", TruncatedKey(2), []byte("key"), "ke", true},
+		{"truncated binary", TruncatedKey(10), binary, "�ab", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := tt.policy(tt.key)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func TestConfigMessageAttributesUsesKeyPolicy(t *testing.T) {
+	// Given
+	cfg := NewConfig(instrumentationName, WithKeyPolicy(TruncatedKey(3)))
+	binary := NewConfig(instrumentationName)
+
+	// When
+	attrs := cfg.messageAttributes(operationReceive, &kafka.Message{Key: []byte("customer-42")})
+	binaryAttrs := binary.messageAttributes(operationReceive, &kafka.Message{Key: []byte{0xff}})
+
+	// Then
+	assert.Contains(t, attrs, semconv.MessagingKafkaMessageKey("cus"))
+	for _, attr := range binaryAttrs {
+		assert.NotEqual(t, semconv.MessagingKafkaMessageKeyKey, attr.Key)
+	}
+}
@@ -0,0 +1,185 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+// Names of the instruments recorded by Reader and Writer.
+const (
+	publishDurationName = "messaging.publish.duration"
+	receiveDurationName = "messaging.receive.duration"
+	publishMessagesName = "messaging.publish.messages"
+	receiveMessagesName = "messaging.receive.messages"
+	publishBytesName    = "messaging.publish.bytes"
+	receiveBytesName    = "messaging.receive.bytes"
+	errorsName          = "messaging.kafka.errors"
+)
+
+// Metrics carry the same messaging.system and messaging.operation.type
+// attributes as spans.
+var (
+	metricSystemKafka  = semconv.MessagingSystemKafka
+	metricOperationKey = semconv.MessagingOperationTypeKey
+	metricTopicKey     = attribute.Key("messaging.destination.name")
+	metricPartitionKey = attribute.Key("messaging.destination.partition.id")
+)
+
+// messagingMetrics holds the instruments shared by Reader and Writer.
+type messagingMetrics struct {
+	publishDuration metric.Float64Histogram
+	receiveDuration metric.Float64Histogram
+	publishMessages metric.Int64Counter
+	receiveMessages metric.Int64Counter
+	publishBytes    metric.Int64Counter
+	receiveBytes    metric.Int64Counter
+	operationErrors metric.Int64Counter
+}
+
+// newMessagingMetrics creates every instrument from meter. Instrument
+// creation errors are reported to the global OpenTelemetry error handler.
+func newMessagingMetrics(meter metric.Meter) *messagingMetrics {
+	var m messagingMetrics
+	var err error
+	var errs []error
+
+	m.publishDuration, err = meter.Float64Histogram(publishDurationName,
+		metric.WithDescription("Duration of publish operations."),
+		metric.WithUnit("s"),
+	)
+	errs = append(errs, err)
+	m.receiveDuration, err = meter.Float64Histogram(receiveDurationName,
+		metric.WithDescription("Duration of receive operations."),
+		metric.WithUnit("s"),
+	)
+	errs = append(errs, err)
+	m.publishMessages, err = meter.Int64Counter(publishMessagesName,
+		metric.WithDescription("Number of messages successfully published."),
+		metric.WithUnit("{message}"),
+	)
+	errs = append(errs, err)
+	m.receiveMessages, err = meter.Int64Counter(receiveMessagesName,
+		metric.WithDescription("Number of messages received."),
+		metric.WithUnit("{message}"),
+	)
+	errs = append(errs, err)
+	m.publishBytes, err = meter.Int64Counter(publishBytesName,
+		metric.WithDescription("Size of the payloads successfully published."),
+		metric.WithUnit("By"),
+	)
+	errs = append(errs, err)
+	m.receiveBytes, err = meter.Int64Counter(receiveBytesName,
+		metric.WithDescription("Size of the payloads received."),
+		metric.WithUnit("By"),
+	)
+	errs = append(errs, err)
+	m.operationErrors, err = meter.Int64Counter(errorsName,
+		metric.WithDescription("Number of failed publish, receive and settle operations."),
+		metric.WithUnit("{error}"),
+	)
+	errs = append(errs, err)
+
+	if err := errors.Join(errs...); err != nil {
+		otel.Handle(err)
+	}
+	return &m
+}
+
+// recordPublish records a write that started at start, of messages to
+// topics. errs holds the outcome of every message, in the same order as
+// topics; the delivered messages are recorded by recordDelivered.
+func (m *messagingMetrics) recordPublish(ctx context.Context, start time.Time, topics []string, errs []error) {
+	elapsed := time.Since(start).Seconds()
+
+	seen := make(map[string]struct{}, 1)
+	for i, topic := range topics {
+		if errs[i] != nil {
+			m.recordPublishError(ctx, topic)
+		}
+		if _, ok := seen[topic]; ok {
+			continue
+		}
+		seen[topic] = struct{}{}
+		m.publishDuration.Record(ctx, elapsed, metric.WithAttributes(
+			metricSystemKafka,
+			metricOperationKey.String(operationPublish),
+			metricTopicKey.String(topic),
+		))
+	}
+}
+
+// recordDelivered records msg, delivered to topic in the partition Kafka set
+// on it.
+func (m *messagingMetrics) recordDelivered(ctx context.Context, topic string, msg *kafka.Message) {
+	attrs := metric.WithAttributes(
+		metricSystemKafka,
+		metricOperationKey.String(operationPublish),
+		metricTopicKey.String(topic),
+		metricPartitionKey.String(strconv.Itoa(msg.Partition)),
+	)
+	m.publishMessages.Add(ctx, 1, attrs)
+	m.publishBytes.Add(ctx, int64(len(msg.Value)), attrs)
+}
+
+// recordPublishError records a message that failed to be published to topic.
+func (m *messagingMetrics) recordPublishError(ctx context.Context, topic string) {
+	m.operationErrors.Add(ctx, 1, metric.WithAttributes(
+		metricSystemKafka,
+		metricOperationKey.String(operationPublish),
+		metricTopicKey.String(topic),
+	))
+}
+
+// recordReceive records a receive operation that started at start and
+// returned msg, or failed with err. Receives interrupted by the cancellation
+// of ctx, as when a consumer shuts down, are not recorded.
+func (m *messagingMetrics) recordReceive(ctx context.Context, start time.Time, msg *kafka.Message, err error) {
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	elapsed := time.Since(start).Seconds()
+
+	if err != nil {
+		attrs := metric.WithAttributes(
+			metricSystemKafka,
+			metricOperationKey.String(operationReceive),
+		)
+		m.receiveDuration.Record(ctx, elapsed, attrs)
+		m.operationErrors.Add(ctx, 1, attrs)
+		return
+	}
+
+	attrs := metric.WithAttributes(
+		metricSystemKafka,
+		metricOperationKey.String(operationReceive),
+		metricTopicKey.String(msg.Topic),
+		metricPartitionKey.String(strconv.Itoa(msg.Partition)),
+	)
+	m.receiveDuration.Record(ctx, elapsed, attrs)
+	m.receiveMessages.Add(ctx, 1, attrs)
+	m.receiveBytes.Add(ctx, int64(len(msg.Value)), attrs)
+}
+
+// recordCommit records the failure of committing msgs, if err is not nil.
+func (m *messagingMetrics) recordCommit(ctx context.Context, msgs []kafka.Message, err error) {
+	if err == nil {
+		return
+	}
+
+	for i := range msgs {
+		m.operationErrors.Add(ctx, 1, metric.WithAttributes(
+			metricSystemKafka,
+			metricOperationKey.String(operationSettle),
+			metricTopicKey.String(msgs[i].Topic),
+			metricPartitionKey.String(strconv.Itoa(msgs[i].Partition)),
+		))
+	}
+}
@@ -1,7 +1,11 @@
 package otelkafkakonsumer
 
 import (
+	"time"
+
+	"github.com/segmentio/kafka-go"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -27,6 +31,14 @@ func WithTracerProvider(tp trace.TracerProvider) Option {
 	})
 }
 
+// WithMeterProvider returns an Option that sets the MeterProvider used for
+// a configuration.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return OptionFunc(func(c *Config) {
+		c.MeterProvider = mp
+	})
+}
+
 // WithAttributes returns an Option that appends attr to the attributes set
 // for every span created.
 func WithAttributes(attr []attribute.KeyValue) Option {
@@ -45,3 +57,150 @@ func WithPropagator(p propagation.TextMapPropagator) Option {
 		c.Propagator = p
 	})
 }
+
+// WithAbandonedSpanTimeout returns an Option that ends the span of a fetched
+// message with the abandoned status when the message is neither committed
+// nor explicitly ended within d. The default is DefaultAbandonedSpanTimeout.
+// A negative d never abandons spans, so the span of every message that is not
+// committed through the Reader, e.g. with Reader.R, is held until Close.
+func WithAbandonedSpanTimeout(d time.Duration) Option {
+	return OptionFunc(func(c *Config) {
+		c.AbandonedSpanTimeout = d
+	})
+}
+
+// WithRetryPolicy returns an Option that sets p as the policy used by
+// Reader.HandleMessage and Reader.Consume to retry failed handlers.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return OptionFunc(func(c *Config) {
+		c.RetryPolicy = p
+	})
+}
+
+// WithDeadLetterQueue returns an Option that makes Reader.Consume write the
+// messages whose handling finally failed to topic through w. When topic is
+// empty, the Topic of w's kafka.Writer is used.
+func WithDeadLetterQueue(w *Writer, topic string) Option {
+	return OptionFunc(func(c *Config) {
+		c.DeadLetterWriter = w
+		c.DeadLetterTopic = topic
+	})
+}
+
+// WithLegacyAttributes returns an Option that makes spans carry the messaging
+// attributes of semconv v1.13.0, e.g. messaging.destination and
+// messaging.message_id, along with the current ones. It eases migrating
+// dashboards and queries to the stable messaging conventions.
+func WithLegacyAttributes() Option {
+	return OptionFunc(func(c *Config) {
+		c.LegacyAttributes = true
+	})
+}
+
+// WithoutConnectionAttributes returns an Option that leaves out of spans the
+// messaging.consumer.group.name, messaging.client.id and server.address
+// attributes NewReader and NewWriter otherwise take from the wrapped client.
+func WithoutConnectionAttributes() Option {
+	return OptionFunc(func(c *Config) {
+		c.OmitConnectionAttributes = true
+	})
+}
+
+// WithSpanNameFormatter returns an Option that sets f as the function naming
+// the spans of Reader and Writer. operation is the messaging operation of the
+// span, one of "create", "publish", "receive", "process" and "settle". The
+// default is DefaultSpanNameFormatter.
+func WithSpanNameFormatter(f func(operation string, msg *kafka.Message) string) Option {
+	return OptionFunc(func(c *Config) {
+		c.SpanNameFormatter = f
+	})
+}
+
+// WithMessageAttributes returns an Option that adds the attributes f derives
+// from the message of every span created, e.g. from its headers. They take
+// precedence over the other attributes of the span. Spans covering several
+// messages pass f the message described on Config.SpanNameFormatter.
+func WithMessageAttributes(f func(msg *kafka.Message) []attribute.KeyValue) Option {
+	return OptionFunc(func(c *Config) {
+		c.MessageAttributes = f
+	})
+}
+
+// WithHeaderCapture returns an Option that records the Kafka headers selected
+// by h as attributes of the message spans.
+func WithHeaderCapture(h HeaderCapture) Option {
+	return OptionFunc(func(c *Config) {
+		c.HeaderCapture = &h
+	})
+}
+
+// WithKeyPolicy returns an Option that sets p as the policy deciding how
+// message keys are recorded on spans, e.g. OmitKey, RawKey, HashedKey,
+// TruncatedKey or a custom func. The default is DefaultKeyPolicy.
+func WithKeyPolicy(p KeyPolicy) Option {
+	return OptionFunc(func(c *Config) {
+		c.KeyPolicy = p
+	})
+}
+
+// WithMessageSampler returns an Option that sets s as the sampler Reader and
+// Writer call before starting a span, to drop it, keep it from being
+// recorded or force it to be sampled based on the message. The trace context
+// keeps being propagated to the services downstream whatever s decides.
+//
+// Forcing a span to be sampled is a no-op unless the sampler of the
+// TracerProvider is wrapped with forcesampler.New.
+func WithMessageSampler(s MessageSampler) Option {
+	return OptionFunc(func(c *Config) {
+		c.MessageSampler = s
+	})
+}
+
+// WithTopicFilter returns an Option that traces only the messages of the
+// topics f returns true for, e.g. one built with TopicsMatching or
+// TopicsNotMatching. Reader and Writer neither start spans for the other
+// messages nor inject a trace context into their headers, but keep recording
+// their metrics.
+func WithTopicFilter(f TopicFilter) Option {
+	return OptionFunc(func(c *Config) {
+		c.TopicFilter = f
+	})
+}
+
+// WithConsumerSpanRelation returns an Option that sets how the receive,
+// process and commit spans of a Reader relate to the context they continue:
+// the producer context found in the message headers, or the context of the
+// commit. The default is RelationChild.
+func WithConsumerSpanRelation(rel ConsumerSpanRelation) Option {
+	return OptionFunc(func(c *Config) {
+		c.ConsumerSpanRelation = rel
+	})
+}
+
+// WithoutBaggage returns an Option that stops the W3C baggage from being
+// propagated through the message headers, unless the propagator set with
+// WithPropagator propagates it itself.
+func WithoutBaggage() Option {
+	return OptionFunc(func(c *Config) {
+		c.OmitBaggage = true
+	})
+}
+
+// WithBaggageRules returns an Option that promotes the headers of consumed
+// messages selected by rules to baggage members, for producers that do not
+// propagate baggage. Members propagated with the baggage header take
+// precedence.
+func WithBaggageRules(rules ...BaggageRule) Option {
+	return OptionFunc(func(c *Config) {
+		c.BaggageRules = append(c.BaggageRules, rules...)
+	})
+}
+
+// WithBaggageAttributes returns an Option that records the baggage members
+// with the given keys as attributes of the message spans, named after their
+// key.
+func WithBaggageAttributes(keys ...string) Option {
+	return OptionFunc(func(c *Config) {
+		c.BaggageAttributes = append(c.BaggageAttributes, keys...)
+	})
+}
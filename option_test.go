@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -17,8 +18,23 @@ func TestWithAttributes(t *testing.T) {
 }
 
 func TestWithPropagator(t *testing.T) {
-	p := propagation.NewCompositeTextMapPropagator()
-	// Use a non-nil value.
-	p = propagation.NewCompositeTextMapPropagator(p)
+	// Propagate baggage, so the propagator is used as is.
+	p := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
 	assert.Equal(t, p, NewConfig(instrumentationName, WithPropagator(p)).Propagator)
 }
+
+func TestWithPropagatorAddsBaggage(t *testing.T) {
+	p := propagation.TraceContext{}
+	assert.ElementsMatch(t,
+		[]string{"traceparent", "tracestate", "baggage"},
+		NewConfig(instrumentationName, WithPropagator(p)).Propagator.Fields(),
+	)
+	assert.Equal(t, p, NewConfig(instrumentationName, WithPropagator(p), WithoutBaggage()).Propagator)
+}
+
+func TestWithMeterProvider(t *testing.T) {
+	mp := noop.NewMeterProvider()
+	c := NewConfig(instrumentationName, WithMeterProvider(mp))
+	assert.Equal(t, mp, c.MeterProvider)
+	assert.NotNil(t, c.Meter)
+}
@@ -0,0 +1,164 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// B3Propagator returns a propagator extracting the B3 single and multiple
+// header formats, whatever the case of the header keys, e.g. X-B3-TraceId,
+// and injecting the B3 multiple headers.
+func B3Propagator() propagation.TextMapPropagator {
+	return foldPropagator{b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader))}
+}
+
+// JaegerPropagator returns a propagator for the uber-trace-id header of
+// Jaeger clients, whatever the case of its key.
+func JaegerPropagator() propagation.TextMapPropagator {
+	return foldPropagator{jaeger.Jaeger{}}
+}
+
+// CompatPropagator returns a propagator for fleets migrating to the W3C
+// trace context. It extracts the W3C, B3 and Jaeger formats in that priority
+// order, and injects both the W3C and B3 formats.
+func CompatPropagator() propagation.TextMapPropagator {
+	return NewMultiFormatPropagator(
+		[]propagation.TextMapPropagator{propagation.TraceContext{}, B3Propagator(), JaegerPropagator()},
+		[]propagation.TextMapPropagator{propagation.TraceContext{}, B3Propagator()},
+	)
+}
+
+// NewMultiFormatPropagator returns a propagator extracting the span context
+// with the first of extract that finds a valid one, and injecting it with
+// every propagator of inject.
+//
+// Unlike propagation.NewCompositeTextMapPropagator, where the last format
+// found wins, extract lists the formats in priority order.
+func NewMultiFormatPropagator(extract, inject []propagation.TextMapPropagator) propagation.TextMapPropagator {
+	return multiFormatPropagator{extract: extract, inject: inject}
+}
+
+type multiFormatPropagator struct {
+	extract []propagation.TextMapPropagator
+	inject  []propagation.TextMapPropagator
+}
+
+func (p multiFormatPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	for _, i := range p.inject {
+		i.Inject(ctx, carrier)
+	}
+}
+
+func (p multiFormatPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	for _, e := range p.extract {
+		if extracted := e.Extract(ctx, carrier); trace.SpanContextFromContext(extracted).IsValid() {
+			return extracted
+		}
+	}
+	return ctx
+}
+
+func (p multiFormatPropagator) Fields() []string {
+	seen := make(map[string]struct{})
+	var fields []string
+	for _, group := range [][]propagation.TextMapPropagator{p.extract, p.inject} {
+		for _, prop := range group {
+			for _, field := range prop.Fields() {
+				if _, ok := seen[field]; !ok {
+					seen[field] = struct{}{}
+					fields = append(fields, field)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// RenameHeaders returns a propagator using p with the header keys renamed as
+// names maps them, from the key p uses to the one found on Kafka, e.g.
+// {"traceparent": "x-trace-parent"}. Keys are read whatever their case.
+func RenameHeaders(p propagation.TextMapPropagator, names map[string]string) propagation.TextMapPropagator {
+	return renamePropagator{p: p, names: names}
+}
+
+type renamePropagator struct {
+	p     propagation.TextMapPropagator
+	names map[string]string
+}
+
+func (r renamePropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	r.p.Inject(ctx, renameCarrier{carrier: carrier, names: r.names})
+}
+
+func (r renamePropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return r.p.Extract(ctx, renameCarrier{carrier: carrier, names: r.names})
+}
+
+func (r renamePropagator) Fields() []string {
+	fields := r.p.Fields()
+	renamed := make([]string, len(fields))
+	for i, field := range fields {
+		renamed[i] = rename(r.names, field)
+	}
+	return renamed
+}
+
+// rename returns the name names maps key to, or key when it has none.
+func rename(names map[string]string, key string) string {
+	if name, ok := names[key]; ok {
+		return name
+	}
+	return key
+}
+
+// renameCarrier is a TextMapCarrier renaming the keys of carrier as names
+// maps them, and reading them whatever their case.
+type renameCarrier struct {
+	carrier propagation.TextMapCarrier
+	names   map[string]string
+}
+
+func (c renameCarrier) Get(key string) string {
+	return foldCarrier{c.carrier}.Get(rename(c.names, key))
+}
+
+func (c renameCarrier) Set(key, value string) {
+	c.carrier.Set(rename(c.names, key), value)
+}
+
+func (c renameCarrier) Keys() []string {
+	return c.carrier.Keys()
+}
+
+// foldPropagator is a propagator extracting with the wrapped one, reading
+// the keys whatever their case.
+type foldPropagator struct {
+	propagation.TextMapPropagator
+}
+
+func (p foldPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return p.TextMapPropagator.Extract(ctx, foldCarrier{carrier})
+}
+
+// foldCarrier is a TextMapCarrier reading keys whatever their case. A key
+// matching exactly takes precedence.
+type foldCarrier struct {
+	propagation.TextMapCarrier
+}
+
+func (c foldCarrier) Get(key string) string {
+	if value := c.TextMapCarrier.Get(key); value != "" {
+		return value
+	}
+	for _, k := range c.TextMapCarrier.Keys() {
+		if strings.EqualFold(k, key) {
+			return c.TextMapCarrier.Get(k)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func testSpanContext(t *testing.T) trace.SpanContext {
+	t.Helper()
+
+	traceID, _ := trace.TraceIDFromHex(testTraceID)
+	spanID, _ := trace.SpanIDFromHex(testSpanID)
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func TestB3PropagatorExtractsHeaderVariants(t *testing.T) {
+	// Given
+	msg := kafka.Message{Headers: []kafka.Header{
+		{Key: "X-B3-TraceId", Value: []byte(testTraceID)},
+		{Key: "X-B3-SpanId", Value: []byte(testSpanID)},
+		{Key: "X-B3-Sampled", Value: []byte("1")},
+	}}
+
+	// When
+	sc := trace.SpanContextFromContext(B3Propagator().Extract(context.Background(), NewMessageCarrier(&msg)))
+
+	// Then
+	assert.Equal(t, testTraceID, sc.TraceID().String())
+	assert.Equal(t, testSpanID, sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+}
+
+func TestJaegerPropagatorExtractsHeaderVariants(t *testing.T) {
+	// Given
+	msg := kafka.Message{Headers: []kafka.Header{
+		{Key: "Uber-Trace-Id", Value: []byte(testTraceID + ":" + testSpanID + ":0:1")},
+	}}
+
+	// When
+	sc := trace.SpanContextFromContext(JaegerPropagator().Extract(context.Background(), NewMessageCarrier(&msg)))
+
+	// Then
+	assert.Equal(t, testTraceID, sc.TraceID().String())
+	assert.Equal(t, testSpanID, sc.SpanID().String())
+}
+
+func TestMultiFormatPropagatorExtractsInPriorityOrder(t *testing.T) {
+	// Given
+	msg := kafka.Message{Headers: []kafka.Header{
+		{Key: "uber-trace-id", Value: []byte("1:2:0:1")},
+		{Key: "b3", Value: []byte(testTraceID + "-" + testSpanID + "-1")},
+	}}
+	p := NewMultiFormatPropagator(
+		[]propagation.TextMapPropagator{propagation.TraceContext{}, B3Propagator(), JaegerPropagator()},
+		nil,
+	)
+
+	// When
+	sc := trace.SpanContextFromContext(p.Extract(context.Background(), NewMessageCarrier(&msg)))
+
+	// Then
+	assert.Equal(t, testTraceID, sc.TraceID().String())
+	assert.Equal(t, testSpanID, sc.SpanID().String())
+}
+
+func TestCompatPropagatorInjectsEveryFormat(t *testing.T) {
+	// Given
+	msg := kafka.Message{}
+	ctx := trace.ContextWithSpanContext(context.Background(), testSpanContext(t))
+
+	// When
+	CompatPropagator().Inject(ctx, NewMessageCarrier(&msg))
+
+	// Then
+	carrier := NewMessageCarrier(&msg)
+	assert.Equal(t, "00-"+testTraceID+"-"+testSpanID+"-01", carrier.Get("traceparent"))
+	assert.Equal(t, testTraceID, carrier.Get("x-b3-traceid"))
+	assert.Empty(t, carrier.Get("uber-trace-id"))
+	assert.Subset(t, CompatPropagator().Fields(), []string{"traceparent", "x-b3-traceid", "uber-trace-id"})
+}
+
+func TestRenameHeaders(t *testing.T) {
+	// Given
+	p := RenameHeaders(propagation.TraceContext{}, map[string]string{"traceparent": "x-trace-parent"})
+	msg := kafka.Message{}
+	ctx := trace.ContextWithSpanContext(context.Background(), testSpanContext(t))
+
+	// When
+	p.Inject(ctx, NewMessageCarrier(&msg))
+	msg.Headers[0].Key = "X-Trace-Parent"
+	sc := trace.SpanContextFromContext(p.Extract(context.Background(), NewMessageCarrier(&msg)))
+
+	// Then
+	assert.Equal(t, testSpanID, sc.SpanID().String())
+	assert.Contains(t, p.Fields(), "x-trace-parent")
+	assert.NotContains(t, p.Fields(), "traceparent")
+}
+
+func TestReaderWithCompatPropagator(t *testing.T) {
+	// Given
+	r := newTestReader(t, WithPropagator(CompatPropagator()))
+	msg := kafka.Message{Topic: "orders", Headers: []kafka.Header{
+		{Key: "uber-trace-id", Value: []byte(testTraceID + ":" + testSpanID + ":0:1")},
+	}}
+
+	// When
+	ctx, _ := r.StartProcessSpan(context.Background(), &msg)
+
+	// Then
+	assert.Equal(t, testTraceID, trace.SpanContextFromContext(ctx).TraceID().String())
+}
@@ -3,125 +3,430 @@ package otelkafkakonsumer
 import (
 	"context"
 	"fmt"
-	"strconv"
-	"sync/atomic"
+	"reflect"
+	"sort"
 	"time"
-	"unsafe"
 
 	"github.com/segmentio/kafka-go"
-	semconv "go.opentelemetry.io/otel/semconv/v1.13.0"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	semconv113 "go.opentelemetry.io/otel/semconv/v1.13.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// messagingKafkaCommitOffsetsKey lists the offset committed for every
+// partition of a commit span, formatted as "topic/partition:offset".
+var messagingKafkaCommitOffsetsKey = attribute.Key("messaging.kafka.commit.offsets")
+
+// Reader wraps a kafka.Reader with tracing and metrics instrumentation.
+//
+// FetchMessage and ReadMessage record a receive span covering the wait for
+// the broker, which ends as soon as the message is returned. Processing the
+// message is covered by a process span, retrieved with StartProcessSpan or
+// HandleMessage. Both spans continue the producer context of the message, and
+// the process span links to the receive span.
+//
+// A message returned by FetchMessage owns its process span, started as soon
+// as the message is fetched, so it covers the message from fetch to commit.
+// The owned span can be retrieved with MessageSpan, MessageContext or
+// StartProcessSpan, and is ended by CommitMessages or explicitly by
+// EndMessageSpan. Until then, r holds the span, so messages committed through
+// the wrapped kafka.Reader keep theirs until they are abandoned: spans left
+// open longer than the WithAbandonedSpanTimeout option allows, five minutes by
+// default, end with the abandoned status. Close ends every span that is still
+// open.
+//
+// A message returned by ReadMessage, which commits it, owns no span. The
+// process span StartProcessSpan starts for it is ended by the caller.
 type Reader struct {
-	R                *kafka.Reader
-	TraceConfig      *Config
-	activeFetchSpan  unsafe.Pointer
-	activeCommitSpan unsafe.Pointer
+	R           *kafka.Reader
+	TraceConfig *Config
+	metrics     *messagingMetrics
+	stats       *statsObserver
+	spans       *spanRegistry
+	receipts    *receiptRegistry
+	// source is where messages are read from and committed to, R unless
+	// replaced by tests.
+	source messageSource
 }
 
-type spanWrapper struct {
-	otelSpan trace.Span
+// messageSource is the part of kafka.Reader that Reader instruments.
+type messageSource interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
 }
 
 // NewReader calls kafka.NewReader and wraps the resulting Consumer with
 // tracing instrumentation.
+//
+// r may be nil, for readers only used to start spans, in which case no
+// connection attributes nor stats are recorded.
 func NewReader(r *kafka.Reader, opts ...Option) (*Reader, error) {
 	cfg := NewConfig(instrumentationName, opts...)
 
-	// Common attributes for all spans this consumer will produce.
+	// Common attributes for all spans this consumer will produce. They come
+	// first, so the attributes set with options take precedence.
+	attrs := []attribute.KeyValue{semconv.MessagingSystemKafka}
+	if !cfg.OmitConnectionAttributes && r != nil {
+		attrs = append(attrs, readerConnectionAttributes(r)...)
+	}
 	cfg.DefaultStartOpts = append(
-		cfg.DefaultStartOpts,
-		trace.WithAttributes(
-			semconv.MessagingDestinationKindTopic,
-			semconv.MessagingOperationReceive,
-		),
+		[]trace.SpanStartOption{trace.WithAttributes(attrs...)},
+		cfg.DefaultStartOpts...,
 	)
 
+	var stats *statsObserver
+	if r != nil {
+		stats = newStatsObserver(cfg.Meter, reflect.TypeOf(kafka.ReaderStats{}), readerStats(r))
+	}
+
 	return &Reader{
-		R:                r,
-		TraceConfig:      cfg,
-		activeFetchSpan:  unsafe.Pointer(&spanWrapper{}),
-		activeCommitSpan: unsafe.Pointer(&spanWrapper{}),
+		R:           r,
+		TraceConfig: cfg,
+		metrics:     newMessagingMetrics(cfg.Meter),
+		stats:       stats,
+		spans:       newSpanRegistry(cfg.AbandonedSpanTimeout),
+		receipts:    newReceiptRegistry(),
+		source:      r,
 	}, nil
 }
 
-func (r *Reader) startSpan(spanName string, msg *kafka.Message) spanWrapper {
-	carrier := NewMessageCarrier(msg)
-	psc := r.TraceConfig.Propagator.Extract(context.Background(), carrier)
+// readerStats returns a snapshot func of r's stats for newStatsObserver.
+func readerStats(r *kafka.Reader) func() (reflect.Value, []attribute.KeyValue) {
+	return func() (reflect.Value, []attribute.KeyValue) {
+		stats := r.Stats()
+		return reflect.ValueOf(stats), []attribute.KeyValue{
+			metricClientIDKey.String(stats.ClientID),
+			metricTopicKey.String(stats.Topic),
+			metricPartitionKey.String(stats.Partition),
+		}
+	}
+}
 
-	opts := r.TraceConfig.MergedSpanStartOptions(
-		trace.WithAttributes(
-			semconv.MessagingDestinationKey.String(msg.Topic),
-			semconv.MessagingMessageIDKey.String(strconv.FormatInt(msg.Offset, 10)),
-			semconv.MessagingKafkaMessageKeyKey.String(string(msg.Key)),
-			semconv.MessagingKafkaPartitionKey.Int64(int64(msg.Partition)),
-		),
+// extract returns the producer context propagated in the headers of msg,
+// along with the baggage promoted from them.
+func (r *Reader) extract(msg *kafka.Message) context.Context {
+	psc := r.TraceConfig.Propagator.Extract(context.Background(), NewMessageCarrier(msg))
+	return r.TraceConfig.promoteHeaders(psc, msg)
+}
+
+func (r *Reader) startSpan(operation string, msg *kafka.Message, extraOpts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	psc := r.extract(msg)
+	if !r.TraceConfig.traces(msg.Topic) {
+		return passThroughSpan(psc)
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(r.TraceConfig.messageAttributes(operation, msg)...),
+		trace.WithAttributes(r.TraceConfig.positionAttributes(msg)...),
+		trace.WithAttributes(r.TraceConfig.headerAttributes(msg)...),
+		trace.WithAttributes(r.TraceConfig.baggageAttributes(psc)...),
 		trace.WithSpanKind(trace.SpanKindConsumer),
-	)
-	ctx, otelSpan := r.TraceConfig.Tracer.Start(psc, spanName, opts...)
+	}
+	opts = append(opts, r.TraceConfig.relationOptions(trace.SpanContextFromContext(psc))...)
+	opts = append(opts, extraOpts...)
+	opts = append(opts, trace.WithAttributes(r.TraceConfig.derivedAttributes(msg)...))
+	opts = r.TraceConfig.MergedSpanStartOptions(opts...)
+	return r.TraceConfig.startSpan(psc, operation, msg, opts...)
+}
+
+// StartProcessSpan returns the process span of msg, and a copy of ctx holding
+// it.
+//
+// When msg was fetched by r, the span is the one msg owns since it was
+// fetched, which CommitMessages or EndMessageSpan end. Otherwise a process
+// span is started, which the caller ends once it is done handling msg, and
+// which links to the receive span of msg when it is the last message
+// ReadMessage returned from its partition.
+//
+// The span continues the producer context of msg as the
+// WithConsumerSpanRelation option decides. It is injected into the headers of
+// msg, so it can be propagated further. The returned context holds the
+// baggage propagated with msg as well.
+func (r *Reader) StartProcessSpan(ctx context.Context, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx, span, _ := r.startProcessSpan(ctx, msg)
+	return ctx, span
+}
 
-	// Inject the current span into the original message, so it can be used to
+// startProcessSpan implements StartProcessSpan, and reports whether msg owns
+// the span as well.
+func (r *Reader) startProcessSpan(ctx context.Context, msg *kafka.Message) (context.Context, trace.Span, bool) {
+	var spanCtx context.Context
+	span, owned := r.spans.get(msg)
+	if owned {
+		spanCtx = trace.ContextWithSpan(r.extract(msg), span)
+	} else {
+		var opts []trace.SpanStartOption
+		if sc, ok := r.receipts.remove(msg); ok {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+		}
+		spanCtx, span = r.startSpan(operationProcess, msg, opts...)
+	}
+
+	// Inject the process span into the original message, so it can be used to
 	// propagate the span.
-	r.TraceConfig.Propagator.Inject(ctx, carrier)
+	if r.TraceConfig.traces(msg.Topic) {
+		r.TraceConfig.Propagator.Inject(spanCtx, NewMessageCarrier(msg))
+	}
 
-	return spanWrapper{otelSpan: otelSpan}
+	if bag := baggage.FromContext(spanCtx); bag.Len() > 0 {
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+	}
+	return trace.ContextWithSpan(ctx, span), span, owned
 }
 
+// FetchMessage fetches the next message and records its receive span, which
+// covers the fetch and continues the producer context of the message as the
+// WithConsumerSpanRelation option decides. The message then owns its process
+// span, which links to the receive span and is open until the message is
+// committed.
 func (r *Reader) FetchMessage(ctx context.Context, message *kafka.Message) error {
 	startTime := time.Now()
-	m, err := r.R.FetchMessage(ctx)
+	m, err := r.source.FetchMessage(ctx)
+	r.metrics.recordReceive(ctx, startTime, &m, err)
 	if err != nil {
 		return err
 	}
 	*message = m
 
-	s := r.startSpan(fmt.Sprintf("fetched from %s", message.Topic), message)
-	active := atomic.SwapPointer(&r.activeFetchSpan, unsafe.Pointer(&s))
-	(*spanWrapper)(active).End(trace.WithTimestamp(startTime))
-	s.End()
+	received := r.receive(message, startTime)
+	if r.TraceConfig.traces(message.Topic) {
+		_, span := r.startSpan(operationProcess, message, trace.WithLinks(trace.Link{SpanContext: received}))
+		r.spans.add(message, span)
+	}
 
 	return nil
 }
 
+// receive records the receive span of msg, received since startTime, and
+// returns its span context.
+func (r *Reader) receive(msg *kafka.Message, startTime time.Time) trace.SpanContext {
+	_, span := r.startSpan(
+		operationReceive,
+		msg,
+		trace.WithTimestamp(startTime),
+	)
+	span.End()
+	return span.SpanContext()
+}
+
+// CommitMessages commits msgs and ends the spans they own with the outcome of
+// the commit.
+//
+// The commit span continues ctx, as the WithConsumerSpanRelation option
+// decides, and links to the span context of every committed message. It
+// records the offset committed for each partition, and the commit error if
+// there is one. Committing no messages only records an empty commit span. The
+// messages of topics filtered out with the WithTopicFilter option are left out
+// of the commit span, which is not started when all of them are.
 func (r *Reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
-	// open span
-	startTime := time.Now()
-	s := r.startSpan(fmt.Sprintf("committed to %s", msgs[0].Topic), &msgs[0])
-	active := atomic.SwapPointer(&r.activeCommitSpan, unsafe.Pointer(&s))
+	span := r.startCommitSpan(ctx, msgs)
+	if len(msgs) == 0 {
+		span.End()
+		return nil
+	}
 
-	err := r.R.CommitMessages(ctx, msgs...)
+	err := r.source.CommitMessages(ctx, msgs...)
+	r.metrics.recordCommit(ctx, msgs, err)
+	endSpan(span, err)
 
-	// end span
-	(*spanWrapper)(active).End(trace.WithTimestamp(startTime))
-	s.End()
+	for i := range msgs {
+		r.EndMessageSpan(msgs[i], err)
+	}
 
 	return err
 }
 
+func (r *Reader) startCommitSpan(ctx context.Context, msgs []kafka.Message) trace.Span {
+	if len(msgs) > 0 {
+		msgs = r.tracedMessages(msgs)
+		if len(msgs) == 0 {
+			_, span := passThroughSpan(ctx)
+			return span
+		}
+	}
+
+	links := make([]trace.Link, 0, len(msgs))
+	for i := range msgs {
+		sc := r.MessageSpan(msgs[i]).SpanContext()
+		if !sc.IsValid() {
+			psc := r.TraceConfig.Propagator.Extract(context.Background(), NewMessageCarrier(&msgs[i]))
+			sc = trace.SpanContextFromContext(psc)
+		}
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	topics, offsets := committedOffsets(msgs)
+	attrs := []attribute.KeyValue{
+		semconv.MessagingOperationTypeSettle,
+		semconv.MessagingBatchMessageCount(len(msgs)),
+		messagingKafkaBatchTopicsKey.StringSlice(topics),
+		messagingKafkaCommitOffsetsKey.StringSlice(offsets),
+	}
+	var destination string
+	if len(topics) == 1 {
+		destination = topics[0]
+		attrs = append(attrs, semconv.MessagingDestinationName(destination))
+	}
+	if r.TraceConfig.LegacyAttributes {
+		attrs = append(attrs, semconv113.MessagingDestinationKindTopic, semconv113.MessagingOperationReceive)
+		if destination != "" {
+			attrs = append(attrs, semconv113.MessagingDestinationKey.String(destination))
+		}
+	}
+
+	shared := &kafka.Message{Topic: destination}
+	opts := r.TraceConfig.MergedSpanStartOptions(
+		trace.WithAttributes(attrs...),
+		trace.WithLinks(links...),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	opts = append(opts, r.TraceConfig.relationOptions(trace.SpanContextFromContext(ctx))...)
+	opts = append(opts, trace.WithAttributes(r.TraceConfig.derivedAttributes(shared)...))
+	_, span := r.TraceConfig.startSpan(ctx, operationSettle, shared, opts...)
+	return span
+}
+
+// tracedMessages returns the messages of msgs whose topic is traced.
+func (r *Reader) tracedMessages(msgs []kafka.Message) []kafka.Message {
+	traced := make([]kafka.Message, 0, len(msgs))
+	for i := range msgs {
+		if r.TraceConfig.traces(msgs[i].Topic) {
+			traced = append(traced, msgs[i])
+		}
+	}
+	return traced
+}
+
+// committedOffsets returns the sorted distinct topics of msgs, and the offset
+// committed for each of their partitions formatted as "topic/partition:offset".
+// Like kafka-go, the committed offset is the one following the highest offset
+// of the partition's messages.
+func committedOffsets(msgs []kafka.Message) (topics []string, offsets []string) {
+	type partition struct {
+		topic     string
+		partition int
+	}
+
+	seen := make(map[string]struct{}, 1)
+	highest := make(map[partition]int64, len(msgs))
+	for i := range msgs {
+		if _, ok := seen[msgs[i].Topic]; !ok {
+			seen[msgs[i].Topic] = struct{}{}
+			topics = append(topics, msgs[i].Topic)
+		}
+		p := partition{topic: msgs[i].Topic, partition: msgs[i].Partition}
+		if offset, ok := highest[p]; !ok || msgs[i].Offset > offset {
+			highest[p] = msgs[i].Offset
+		}
+	}
+	sort.Strings(topics)
+
+	offsets = make([]string, 0, len(highest))
+	for p, offset := range highest {
+		offsets = append(offsets, fmt.Sprintf("%s/%d:%d", p.topic, p.partition, offset+1))
+	}
+	sort.Strings(offsets)
+	return topics, offsets
+}
+
+// ReadMessage reads and commits the next message. Its receive span covers the
+// read and is ended before ReadMessage returns. The process span
+// StartProcessSpan then starts for the message links to it.
 func (r *Reader) ReadMessage(ctx context.Context) (*kafka.Message, error) {
-	endTime := time.Now()
-	msg, err := r.R.ReadMessage(ctx)
+	startTime := time.Now()
+	msg, err := r.source.ReadMessage(ctx)
+	r.metrics.recordReceive(ctx, startTime, &msg, err)
 	if err == nil {
-		s := r.startSpan(fmt.Sprintf("received from %s", msg.Topic), &msg)
-		active := atomic.SwapPointer(&r.activeFetchSpan, unsafe.Pointer(&s))
-		(*spanWrapper)(active).End(trace.WithTimestamp(endTime))
-		s.End()
+		received := r.receive(&msg, startTime)
+		if r.TraceConfig.traces(msg.Topic) {
+			r.receipts.add(&msg, received)
+		}
 	}
 	return &msg, err
 }
 
-func (s spanWrapper) End(options ...trace.SpanEndOption) {
-	if s.otelSpan != nil {
-		s.otelSpan.End(options...)
+// MessageSpan returns the open span owned by msg, or a no-op span when msg
+// was not fetched by r or its span has already ended.
+func (r *Reader) MessageSpan(msg kafka.Message) trace.Span {
+	if span, ok := r.spans.get(&msg); ok {
+		return span
 	}
+	return trace.SpanFromContext(context.Background())
 }
 
-// Close calls the underlying Consumer.Close and if polling is enabled, ends
-// any remaining span.
+// MessageContext returns a copy of ctx holding the open span owned by msg, so
+// the spans started from it are children of the message span.
+func (r *Reader) MessageContext(ctx context.Context, msg kafka.Message) context.Context {
+	return trace.ContextWithSpan(ctx, r.MessageSpan(msg))
+}
+
+// EndMessageSpan ends the open span owned by msg, recording err if it is not
+// nil. It does nothing if the span has already ended.
+func (r *Reader) EndMessageSpan(msg kafka.Message, err error) {
+	if span, ok := r.spans.remove(&msg); ok {
+		endSpan(span, err)
+	}
+}
+
+// Consume fetches messages until ctx is cancelled and passes each of them to
+// handler, committing the message only when handler succeeds.
+//
+// Each message is handled with HandleMessage, so handler receives a context
+// holding the process span of the message and is retried as the
+// WithRetryPolicy option allows. A message whose handling finally fails is
+// written to the dead-letter queue set with the WithDeadLetterQueue option,
+// and committed only once that write succeeds. Without a dead-letter queue,
+// or when the write fails, the message is not committed, but committing a
+// later message of the same partition moves the consumer group past it.
+//
+// Consume returns nil once ctx is cancelled, or the first fetch or commit
+// error otherwise.
+func (r *Reader) Consume(ctx context.Context, handler func(ctx context.Context, msg kafka.Message) error) error {
+	for {
+		msg := kafka.Message{}
+		if err := r.FetchMessage(ctx, &msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		// The process span already records the handler error, and is left
+		// open for the dead-letter write and the commit.
+		// The dead-letter message is built from the handled one, so it carries
+		// the retry count.
+		if handled, sc, err := r.handleMessage(ctx, msg, handler); err != nil {
+			if r.TraceConfig.DeadLetterWriter == nil || ctx.Err() != nil {
+				r.EndMessageSpan(msg, nil)
+				continue
+			}
+			if dlqErr := r.deadLetter(ctx, handled, err, sc); dlqErr != nil {
+				r.EndMessageSpan(msg, dlqErr)
+				continue
+			}
+		}
+
+		if err := r.CommitMessages(r.MessageContext(ctx, msg), msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Close calls the underlying Consumer.Close, stops reporting its stats and
+// ends every message span that is still open.
 func (r *Reader) Close() error {
 	err := r.R.Close()
-	(*spanWrapper)(atomic.LoadPointer(&r.activeFetchSpan)).End()
-	(*spanWrapper)(atomic.LoadPointer(&r.activeCommitSpan)).End()
+	r.stats.unregister()
+	for _, span := range r.spans.removeAll() {
+		span.End()
+	}
 	return err
 }
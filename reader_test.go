@@ -0,0 +1,680 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestReader(t *testing.T, opts ...Option) *Reader {
+	t.Helper()
+
+	r, err := NewReader(kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "orders",
+	}), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+// fakeSource is a messageSource serving msgs in memory, so a Reader can fetch
+// and commit without a broker. Once msgs are all served, fetches block until
+// their context is done, and signal idle if it is set.
+type fakeSource struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	delay     time.Duration
+	committed []kafka.Message
+	commitErr error
+	idle      chan struct{}
+}
+
+func (f *fakeSource) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	if len(f.msgs) == 0 {
+		f.mu.Unlock()
+		select {
+		case f.idle <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	f.mu.Unlock()
+	return msg, nil
+}
+
+func (f *fakeSource) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	return f.FetchMessage(ctx)
+}
+
+func (f *fakeSource) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.committed = append(f.committed, msgs...)
+	return f.commitErr
+}
+
+// newFetchingReader returns a Reader fetching msgs from a fakeSource.
+func newFetchingReader(t *testing.T, msgs []kafka.Message, opts ...Option) (*Reader, *fakeSource) {
+	t.Helper()
+
+	source := &fakeSource{msgs: msgs}
+	r := newTestReader(t, opts...)
+	r.source = source
+	return r, source
+}
+
+// fetchMessage fetches the next message of r, which must have one.
+func fetchMessage(t *testing.T, r *Reader) kafka.Message {
+	t.Helper()
+
+	var msg kafka.Message
+	if err := r.FetchMessage(context.Background(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// consume runs r.Consume with handler until every message of source is
+// handled, and returns its error.
+func consume(t *testing.T, r *Reader, source *fakeSource, handler func(ctx context.Context, msg kafka.Message) error) error {
+	t.Helper()
+
+	source.idle = make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Consume(ctx, handler) }()
+
+	select {
+	case <-source.idle:
+	case <-time.After(5 * time.Second):
+		t.Error("messages not consumed in time")
+	}
+	cancel()
+	return <-done
+}
+
+func TestReaderConsumeStopsWhenContextCancelled(t *testing.T) {
+	// Given
+	r := newTestReader(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When
+	err := r.Consume(ctx, func(context.Context, kafka.Message) error {
+		t.Fatal("handler called without a message")
+		return nil
+	})
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func TestReaderConsumeParentsHandlerSpansToProcessSpan(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	r, source := newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 7}}, WithTracerProvider(tp))
+
+	// When
+	err := consume(t, r, source, func(ctx context.Context, _ kafka.Message) error {
+		_, span := tp.Tracer("handler").Start(ctx, "handle")
+		span.End()
+		return nil
+	})
+
+	// Then
+	assert.NoError(t, err)
+	process := spansByName(sr.Ended(), "process orders")
+	handle := spansByName(sr.Ended(), "handle")
+	if assert.Len(t, process, 1) && assert.Len(t, handle, 1) {
+		assert.Equal(t, process[0].SpanContext(), handle[0].Parent())
+		assert.Equal(t, codes.Unset, process[0].Status().Code)
+	}
+	assert.Equal(t, []kafka.Message{{Topic: "orders", Offset: 7}}, source.committed)
+}
+
+func TestReaderConsumeCommitsOnlyHandledMessages(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, source := newFetchingReader(t, []kafka.Message{
+		{Topic: "orders", Offset: 1},
+		{Topic: "orders", Offset: 2},
+	}, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	// When
+	err := consume(t, r, source, func(_ context.Context, msg kafka.Message) error {
+		if msg.Offset == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []kafka.Message{{Topic: "orders", Offset: 2}}, source.committed)
+	if process := spansByName(sr.Ended(), "process orders"); assert.Len(t, process, 2) {
+		assert.Contains(t, process[0].Attributes(), semconv.MessagingKafkaOffset(1))
+		assert.Equal(t, codes.Error, process[0].Status().Code)
+		assert.Equal(t, "boom", process[0].Status().Description)
+		assert.Contains(t, process[1].Attributes(), semconv.MessagingKafkaOffset(2))
+		assert.Equal(t, codes.Unset, process[1].Status().Code)
+	}
+}
+
+func TestReaderMessageSpanLifecycle(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, _ := newFetchingReader(t, []kafka.Message{{Topic: "orders", Partition: 2, Offset: 42}},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+	)
+	msg := fetchMessage(t, r)
+
+	// When
+	got := r.MessageSpan(msg)
+	recording := got.IsRecording()
+	ctx := r.MessageContext(context.Background(), msg)
+	r.EndMessageSpan(msg, errors.New("failed"))
+	r.EndMessageSpan(msg, nil)
+
+	// Then
+	assert.True(t, recording)
+	assert.Equal(t, got, trace.SpanFromContext(ctx))
+	if process := spansByName(sr.Ended(), "process orders"); assert.Len(t, process, 1) {
+		assert.Equal(t, got.SpanContext(), process[0].SpanContext())
+		assert.Equal(t, codes.Error, process[0].Status().Code)
+	}
+	assert.Len(t, sr.Ended(), 2)
+	assert.False(t, r.MessageSpan(msg).SpanContext().IsValid())
+}
+
+func TestReaderEndsMessageSpansConcurrently(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	const goroutines, perGoroutine = 32, 50
+	var msgs []kafka.Message
+	for partition := 0; partition < goroutines; partition++ {
+		for offset := 0; offset < perGoroutine; offset++ {
+			msgs = append(msgs, kafka.Message{Topic: "orders", Partition: partition, Offset: int64(offset)})
+		}
+	}
+	r, _ := newFetchingReader(t, msgs, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	// When
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				msg := fetchMessage(t, r)
+				_, child := r.TraceConfig.Tracer.Start(r.MessageContext(context.Background(), msg), "work")
+				child.End()
+				r.EndMessageSpan(msg, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	// Every message has a receive, a process and a work span.
+	assert.Len(t, sr.Ended(), 3*len(msgs))
+	assert.Len(t, spansByName(sr.Ended(), "process orders"), len(msgs))
+}
+
+func TestReaderCloseEndsOpenSpans(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, _ := newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 1}},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+	)
+	_ = fetchMessage(t, r)
+	opened := len(spansByName(sr.Ended(), "process orders"))
+
+	// When
+	_ = r.Close()
+
+	// Then
+	assert.Zero(t, opened)
+	assert.Len(t, spansByName(sr.Ended(), "process orders"), 1)
+}
+
+func TestReaderAbandonsUncommittedMessageSpans(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, _ := newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 1}, {Topic: "audit", Offset: 2}},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithAbandonedSpanTimeout(10*time.Millisecond),
+		WithTopicFilter(func(topic string) bool { return topic != "audit" }),
+	)
+
+	// When
+	msg := fetchMessage(t, r)
+	filtered := fetchMessage(t, r)
+	_, held := r.spans.get(&filtered)
+
+	// Then
+	assert.False(t, held)
+	assert.Eventually(t, func() bool {
+		return len(spansByName(sr.Ended(), "process orders")) == 1
+	}, time.Second, time.Millisecond)
+	process := spansByName(sr.Ended(), "process orders")[0]
+	assert.Equal(t, codes.Error, process.Status().Code)
+	assert.Equal(t, abandonedStatus, process.Status().Description)
+	assert.False(t, r.MessageSpan(msg).SpanContext().IsValid())
+}
+
+func TestReaderCommitMessagesEndsSpansWithCommitOutcome(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, source := newFetchingReader(t, []kafka.Message{
+		{Topic: "orders", Partition: 0, Offset: 1},
+		{Topic: "orders", Partition: 1, Offset: 5},
+		{Topic: "payments", Partition: 0, Offset: 9},
+		{Topic: "orders", Partition: 1, Offset: 3},
+	}, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+	source.commitErr = errors.New("commit failed")
+	msgs := make([]kafka.Message, 4)
+	for i := range msgs {
+		msgs[i] = fetchMessage(t, r)
+	}
+	received := len(sr.Ended())
+
+	// When
+	err := r.CommitMessages(context.Background(), msgs...)
+
+	// Then
+	assert.Error(t, err)
+	assert.Equal(t, msgs, source.committed)
+	// Message spans end after the commit span, in the order of msgs.
+	fetched := sr.Ended()[received+1:]
+	if assert.Len(t, fetched, 4) {
+		for _, s := range fetched {
+			assert.Equal(t, codes.Error, s.Status().Code)
+		}
+	}
+	commit := spansByName(sr.Ended(), "settle")
+	if !assert.Len(t, commit, 1) {
+		return
+	}
+	assert.Equal(t, codes.Error, commit[0].Status().Code)
+	assert.Contains(t, commit[0].Attributes(), messagingKafkaBatchTopicsKey.StringSlice([]string{"orders", "payments"}))
+	assert.Contains(t, commit[0].Attributes(), messagingKafkaCommitOffsetsKey.StringSlice([]string{
+		"orders/0:2", "orders/1:6", "payments/0:10",
+	}))
+	if links := commit[0].Links(); assert.Len(t, links, 4) {
+		for i, s := range fetched {
+			assert.Equal(t, s.SpanContext().SpanID(), links[i].SpanContext.SpanID())
+		}
+	}
+}
+
+func TestReaderCommitMessagesWithoutMessages(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r := newTestReader(t, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	// When
+	err := r.CommitMessages(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	if commit := spansByName(sr.Ended(), "settle"); assert.Len(t, commit, 1) {
+		assert.Equal(t, codes.Unset, commit[0].Status().Code)
+		assert.Contains(t, commit[0].Attributes(), semconv.MessagingBatchMessageCount(0))
+		assert.Empty(t, commit[0].Links())
+	}
+}
+
+func TestReaderRecordsMetrics(t *testing.T) {
+	// Given
+	reader := sdkmetric.NewManualReader()
+	r := newTestReader(t, WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	msg := kafka.Message{Topic: "orders", Partition: 2, Offset: 7, Value: []byte("123")}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When
+	r.metrics.recordReceive(context.Background(), time.Now(), &msg, nil)
+	fetchErr := r.FetchMessage(cancelled, &kafka.Message{})
+	// The reader has no GroupID, so kafka-go refuses to commit.
+	commitErr := r.CommitMessages(context.Background(), msg)
+
+	// Then
+	assert.Error(t, fetchErr)
+	assert.Error(t, commitErr)
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+
+	received := attribute.NewSet(
+		metricSystemKafka,
+		metricOperationKey.String(operationReceive),
+		metricTopicKey.String("orders"),
+		metricPartitionKey.String("2"),
+	)
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints:  []metricdata.DataPoint[int64]{{Attributes: received, Value: 1}},
+	}, got[receiveMessagesName], metricdatatest.IgnoreTimestamp())
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints:  []metricdata.DataPoint[int64]{{Attributes: received, Value: 3}},
+	}, got[receiveBytesName], metricdatatest.IgnoreTimestamp())
+	// The cancelled fetch is not recorded, neither as a receive nor as an
+	// error.
+	if h, ok := got[receiveDurationName].(metricdata.Histogram[float64]); assert.True(t, ok) && assert.Len(t, h.DataPoints, 1) {
+		assert.Equal(t, received, h.DataPoints[0].Attributes)
+	}
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints: []metricdata.DataPoint[int64]{{
+			Attributes: attribute.NewSet(
+				metricSystemKafka,
+				metricOperationKey.String(operationSettle),
+				metricTopicKey.String("orders"),
+				metricPartitionKey.String("2"),
+			),
+			Value: 1,
+		}},
+	}, got[errorsName], metricdatatest.IgnoreTimestamp())
+}
+
+func TestNewReaderAddsConnectionAttributes(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	kr := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"broker-1:9093", "broker-2:9093"},
+		GroupID: "orders-cg",
+		Topic:   "orders",
+		Dialer:  &kafka.Dialer{ClientID: "orders-service"},
+	})
+	r, err := NewReader(kr, WithTracerProvider(tp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	omitted, err := NewReader(kr, WithTracerProvider(tp), WithoutConnectionAttributes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	_, span := r.startSpan(operationReceive, &kafka.Message{Topic: "orders"})
+	span.End()
+	_, span = omitted.startSpan(operationReceive, &kafka.Message{Topic: "orders"})
+	span.End()
+
+	// Then
+	spans := sr.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Subset(t, spans[0].Attributes(), []attribute.KeyValue{
+			semconv.MessagingSystemKafka,
+			semconv.MessagingConsumerGroupName("orders-cg"),
+			semconv.MessagingClientID("orders-service"),
+			semconv.ServerAddress("broker-1"),
+			semconv.ServerPort(9093),
+		})
+		assert.NotContains(t, spans[1].Attributes(), semconv.MessagingConsumerGroupName("orders-cg"))
+		assert.Contains(t, spans[1].Attributes(), semconv.MessagingSystemKafka)
+	}
+}
+
+func TestNewReaderWithoutKafkaReader(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+
+	// When
+	r, err := NewReader(nil, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := r.StartProcessSpan(context.Background(), &kafka.Message{Topic: "orders"})
+	span.End()
+
+	// Then
+	assert.Nil(t, r.stats)
+	if spans := sr.Ended(); assert.Len(t, spans, 1) {
+		assert.Contains(t, spans[0].Attributes(), semconv.MessagingSystemKafka)
+		for _, kv := range spans[0].Attributes() {
+			assert.NotEqual(t, semconv.ServerAddressKey, kv.Key)
+		}
+	}
+	assert.NotPanics(t, r.stats.unregister)
+}
+
+func TestReaderUsesSpanNameFormatter(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithSpanNameFormatter(func(operation string, msg *kafka.Message) string {
+			return "kafka." + operation + "." + msg.Topic
+		}),
+	)
+
+	// When
+	_, span := r.startSpan(operationProcess, &kafka.Message{Topic: "orders"})
+	span.End()
+	_ = r.CommitMessages(context.Background())
+
+	// Then
+	if spans := sr.Ended(); assert.Len(t, spans, 2) {
+		assert.Equal(t, "kafka.process.orders", spans[0].Name())
+		assert.Equal(t, "kafka.settle.", spans[1].Name())
+	}
+}
+
+func TestReaderAddsMessageAttributes(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithMessageAttributes(func(msg *kafka.Message) []attribute.KeyValue {
+			return []attribute.KeyValue{
+				attribute.String("tenant.id", NewMessageCarrier(msg).Get("tenant")),
+				semconv.MessagingDestinationName("orders-alias"),
+			}
+		}),
+	)
+	msg := kafka.Message{Topic: "orders", Headers: []kafka.Header{{Key: "tenant", Value: []byte("acme")}}}
+
+	// When
+	_, span := r.startSpan(operationReceive, &msg)
+	span.End()
+
+	// Then
+	if spans := sr.Ended(); assert.Len(t, spans, 1) {
+		assert.Contains(t, spans[0].Attributes(), attribute.String("tenant.id", "acme"))
+		assert.Contains(t, spans[0].Attributes(), semconv.MessagingDestinationName("orders-alias"))
+		assert.NotContains(t, spans[0].Attributes(), semconv.MessagingDestinationName("orders"))
+	}
+}
+
+func TestReaderSkipsFilteredTopics(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, _ := newFetchingReader(t, []kafka.Message{
+		{Topic: "audit", Offset: 1},
+		{Topic: "orders", Offset: 2},
+	},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithPropagator(propagation.TraceContext{}),
+		WithTopicFilter(func(topic string) bool { return topic != "audit" }),
+	)
+	msgs := make([]kafka.Message, 2)
+
+	// When
+	for i := range msgs {
+		msgs[i] = fetchMessage(t, r)
+		_, _ = r.StartProcessSpan(context.Background(), &msgs[i])
+	}
+	_ = r.CommitMessages(context.Background(), msgs...)
+	_ = r.CommitMessages(context.Background(), kafka.Message{Topic: "audit", Offset: 3})
+
+	// Then
+	assert.Empty(t, msgs[0].Headers)
+	assert.NotEmpty(t, msgs[1].Headers)
+	assert.Empty(t, spansByName(sr.Ended(), "receive audit"))
+	assert.Empty(t, spansByName(sr.Ended(), "process audit"))
+	assert.Len(t, spansByName(sr.Ended(), "receive orders"), 1)
+	assert.Len(t, spansByName(sr.Ended(), "process orders"), 1)
+	if commit := spansByName(sr.Ended(), "settle orders"); assert.Len(t, commit, 1) {
+		assert.Contains(t, commit[0].Attributes(), semconv.MessagingBatchMessageCount(1))
+		assert.Len(t, commit[0].Links(), 1)
+	}
+	assert.Len(t, sr.Ended(), 3)
+}
+
+func TestReaderSeparatesReceiveAndProcessSpans(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	producer := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	fetched := kafka.Message{Topic: "orders", Partition: 1, Offset: 7}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), producer), NewMessageCarrier(&fetched))
+	r, source := newFetchingReader(t, []kafka.Message{fetched},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithPropagator(propagation.TraceContext{}),
+	)
+	source.delay = 10 * time.Millisecond
+
+	// When
+	msg := fetchMessage(t, r)
+	receivedEnded := len(sr.Ended())
+	ctx, span := r.StartProcessSpan(context.Background(), &msg)
+	_ = r.CommitMessages(ctx, msg)
+
+	// Then
+	assert.Equal(t, 1, receivedEnded)
+	receive := spansByName(sr.Ended(), "receive orders")
+	process := spansByName(sr.Ended(), "process orders")
+	commit := spansByName(sr.Ended(), "settle orders")
+	if !assert.Len(t, receive, 1) || !assert.Len(t, process, 1) || !assert.Len(t, commit, 1) {
+		return
+	}
+	// The receive span covers the wait for the broker, and the process span
+	// starts once the message is received.
+	assert.GreaterOrEqual(t, receive[0].EndTime().Sub(receive[0].StartTime()), source.delay)
+	assert.False(t, process[0].StartTime().Before(receive[0].EndTime()))
+	assert.Equal(t, span.SpanContext(), process[0].SpanContext())
+	assert.Equal(t, span, trace.SpanFromContext(ctx))
+	for _, s := range []sdktrace.ReadOnlySpan{receive[0], process[0]} {
+		assert.Equal(t, producer.SpanID(), s.Parent().SpanID())
+		assert.Subset(t, s.Attributes(), []attribute.KeyValue{
+			semconv.MessagingDestinationName("orders"),
+			semconv.MessagingDestinationPartitionID("1"),
+			semconv.MessagingKafkaOffset(7),
+		})
+	}
+	assert.True(t, hasLink(process[0], receive[0].SpanContext()))
+	assert.True(t, hasLink(commit[0], process[0].SpanContext()))
+	assert.Equal(t, process[0].SpanContext().SpanID(), commit[0].Parent().SpanID())
+	injected := propagation.TraceContext{}.Extract(context.Background(), NewMessageCarrier(&msg))
+	assert.Equal(t, process[0].SpanContext().SpanID(), trace.SpanContextFromContext(injected).SpanID())
+}
+
+func TestReaderLinksProcessSpanOfReadMessageToReceiveSpan(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, _ := newFetchingReader(t, []kafka.Message{
+		{Topic: "orders", Partition: 1, Offset: 7},
+		{Topic: "orders", Partition: 1, Offset: 8},
+		{Topic: "orders", Partition: 1, Offset: 9},
+	}, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	// When
+	msg, err := r.ReadMessage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := r.StartProcessSpan(context.Background(), msg)
+	span.End()
+	// Only the last message read from a partition is linked.
+	first, _ := r.ReadMessage(context.Background())
+	second, _ := r.ReadMessage(context.Background())
+	_, unlinked := r.StartProcessSpan(context.Background(), first)
+	unlinked.End()
+
+	// Then
+	assert.Equal(t, int64(9), second.Offset)
+	receive := spansByName(sr.Ended(), "receive orders")
+	process := spansByName(sr.Ended(), "process orders")
+	if !assert.Len(t, receive, 3) || !assert.Len(t, process, 2) {
+		return
+	}
+	assert.True(t, hasLink(process[0], receive[0].SpanContext()))
+	assert.Empty(t, process[1].Links())
+	assert.False(t, r.MessageSpan(*msg).SpanContext().IsValid())
+}
+
+func TestReaderPropagatesContextOfUnsampledSpans(t *testing.T) {
+	for _, decision := range []SamplingDecision{SamplingDrop, SamplingNonRecording} {
+		// Given
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		r := newTestReader(t,
+			WithTracerProvider(tp),
+			WithPropagator(propagation.TraceContext{}),
+			WithMessageSampler(func(string, *kafka.Message) SamplingDecision { return decision }),
+		)
+		ctx, producer := tp.Tracer("test").Start(context.Background(), "producer")
+		producer.End()
+		msg := kafka.Message{Topic: "orders"}
+		propagation.TraceContext{}.Inject(ctx, NewMessageCarrier(&msg))
+
+		// When
+		_, span := r.StartProcessSpan(context.Background(), &msg)
+		span.End()
+
+		// Then
+		sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), NewMessageCarrier(&msg)))
+		assert.Equal(t, producer.SpanContext().TraceID(), sc.TraceID(), "decision %d", decision)
+		if decision == SamplingDrop {
+			assert.Equal(t, producer.SpanContext().SpanID(), sc.SpanID())
+		} else {
+			assert.NotEqual(t, producer.SpanContext().SpanID(), sc.SpanID())
+			assert.False(t, sc.IsSampled())
+		}
+		assert.Len(t, sr.Ended(), 1)
+	}
+}
@@ -0,0 +1,38 @@
+package otelkafkakonsumer
+
+import "go.opentelemetry.io/otel/trace"
+
+// ConsumerSpanRelation is how the spans of a Reader relate to the context
+// they continue: the producer context of a fetched or read message, or the
+// context a commit is made from.
+type ConsumerSpanRelation int
+
+const (
+	// RelationChild makes the spans children of the context they continue.
+	RelationChild ConsumerSpanRelation = iota
+	// RelationLink starts the spans in a new trace, linked to the context
+	// they continue, as the messaging conventions recommend for consumers
+	// processing messages long after they were produced.
+	RelationLink
+	// RelationBoth makes the spans children of the context they continue,
+	// and links them to it as well.
+	RelationBoth
+)
+
+// relationOptions returns the options relating a span to parent as the
+// ConsumerSpanRelation of c requires.
+func (c *Config) relationOptions(parent trace.SpanContext) []trace.SpanStartOption {
+	switch c.ConsumerSpanRelation {
+	case RelationLink:
+		opts := []trace.SpanStartOption{trace.WithNewRoot()}
+		if parent.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: parent}))
+		}
+		return opts
+	case RelationBoth:
+		if parent.IsValid() {
+			return []trace.SpanStartOption{trace.WithLinks(trace.Link{SpanContext: parent})}
+		}
+	}
+	return nil
+}
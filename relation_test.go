@@ -0,0 +1,78 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestReaderConsumerSpanRelation(t *testing.T) {
+	producer := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	for _, tc := range []struct {
+		name     string
+		relation ConsumerSpanRelation
+		child    bool
+		link     bool
+	}{
+		{name: "child", relation: RelationChild, child: true},
+		{name: "link", relation: RelationLink, link: true},
+		{name: "both", relation: RelationBoth, child: true, link: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			sr := tracetest.NewSpanRecorder()
+			fetched := kafka.Message{Topic: "orders"}
+			propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), producer), NewMessageCarrier(&fetched))
+			r, _ := newFetchingReader(t, []kafka.Message{fetched},
+				WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+				WithPropagator(propagation.TraceContext{}),
+				WithConsumerSpanRelation(tc.relation),
+			)
+			ctx, caller := r.TraceConfig.Tracer.Start(context.Background(), "caller")
+
+			// When
+			msg := fetchMessage(t, r)
+			_, _ = r.StartProcessSpan(context.Background(), &msg)
+			_ = r.CommitMessages(ctx, msg)
+			caller.End()
+
+			// Then
+			receive := spansByName(sr.Ended(), "receive orders")
+			process := spansByName(sr.Ended(), "process orders")
+			commit := spansByName(sr.Ended(), "settle orders")
+			if !assert.Len(t, receive, 1) || !assert.Len(t, process, 1) || !assert.Len(t, commit, 1) {
+				return
+			}
+			for _, s := range []sdktrace.ReadOnlySpan{receive[0], process[0]} {
+				assert.Equal(t, tc.child, s.Parent().Equal(producer))
+				assert.Equal(t, tc.child, s.SpanContext().TraceID() == producer.TraceID())
+				assert.Equal(t, tc.link, hasLink(s, producer))
+			}
+			assert.True(t, hasLink(process[0], receive[0].SpanContext()))
+			assert.Equal(t, tc.child, commit[0].Parent().SpanID() == caller.SpanContext().SpanID())
+			assert.Equal(t, tc.link, hasLink(commit[0], caller.SpanContext()))
+			assert.True(t, hasLink(commit[0], process[0].SpanContext()))
+		})
+	}
+}
+
+func hasLink(span sdktrace.ReadOnlySpan, sc trace.SpanContext) bool {
+	for _, l := range span.Links() {
+		if l.SpanContext.SpanID() == sc.SpanID() && l.SpanContext.TraceID() == sc.TraceID() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryCountHeader is the message header holding how many times a message has
+// been retried, so downstream tooling can see it.
+const RetryCountHeader = "x-retry-count"
+
+// Outcomes of handling a message, recorded on its process span.
+const (
+	retryOutcomeSucceeded    = "succeeded"
+	retryOutcomeExhausted    = "exhausted"
+	retryOutcomeNotRetryable = "not_retryable"
+	retryOutcomeCancelled    = "cancelled"
+)
+
+// retryAttemptEvent is the name of the span event recorded for every
+// attempt to handle a message.
+const retryAttemptEvent = "attempt"
+
+var (
+	messagingKafkaRetryAttemptKey = attribute.Key("messaging.kafka.retry.attempt")
+	messagingKafkaRetryCountKey   = attribute.Key("messaging.kafka.retry.count")
+	messagingKafkaRetryOutcomeKey = attribute.Key("messaging.kafka.retry.outcome")
+	messagingKafkaRetryBackoffKey = attribute.Key("messaging.kafka.retry.backoff_ms")
+)
+
+// RetryPolicy configures how a failed message handler is retried.
+//
+// The zero value calls the handler only once.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the handler is called for a
+	// message, including the first call. Values below 1 mean 1.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every retry. Values
+	// below 1 mean 2.
+	Multiplier float64
+	// Retryable reports whether a handler error is worth retrying. A nil
+	// Retryable retries every error.
+	Retryable func(err error) bool
+}
+
+// attempts returns the maximum number of attempts allowed by p.
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// retryable reports whether err may be retried under p.
+func (p RetryPolicy) retryable(err error) bool {
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// backoff returns the delay before the given retry, starting from 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// HandleMessage calls handler for msg under a process span started with
+// StartProcessSpan, retrying it as the WithRetryPolicy option allows.
+//
+// handler receives a context holding the process span, so the spans it
+// starts are children of it. Every attempt is recorded as a span event with
+// its attempt number, and retries carry their count in the RetryCountHeader
+// header of the message passed to handler. That message has its own copy of
+// the headers of msg, so the caller's headers are left unchanged. The process
+// span records the retry count, the final outcome and the last handler error.
+// When msg was fetched by r, the span is owned by msg and left open, to be
+// ended by CommitMessages or EndMessageSpan. Otherwise it ends before
+// HandleMessage returns.
+//
+// HandleMessage returns the last handler error, or ctx's error when ctx is
+// cancelled while waiting for a retry.
+func (r *Reader) HandleMessage(ctx context.Context, msg kafka.Message, handler func(ctx context.Context, msg kafka.Message) error) error {
+	_, _, err := r.handleMessage(ctx, msg, handler)
+	return err
+}
+
+// handleMessage implements HandleMessage, and returns the message as last
+// passed to handler, with its retry count, and the span context of the
+// process span as well.
+func (r *Reader) handleMessage(ctx context.Context, msg kafka.Message, handler func(ctx context.Context, msg kafka.Message) error) (kafka.Message, trace.SpanContext, error) {
+	// msg shares its headers with the caller's copy, so they are copied
+	// before the process span and retry count are set into them.
+	msg.Headers = slices.Clone(msg.Headers)
+	ctx, span, owned := r.startProcessSpan(ctx, &msg)
+
+	policy := r.TraceConfig.RetryPolicy
+	outcome, attempt := retryOutcomeSucceeded, 1
+	var err error
+	for ; ; attempt++ {
+		if attempt > 1 {
+			NewMessageCarrier(&msg).Set(RetryCountHeader, strconv.Itoa(attempt-1))
+		}
+
+		err = handler(ctx, msg)
+		attrs := []attribute.KeyValue{messagingKafkaRetryAttemptKey.Int(attempt)}
+		if err == nil {
+			span.AddEvent(retryAttemptEvent, trace.WithAttributes(attrs...))
+			break
+		}
+		attrs = append(attrs, semconv.ExceptionMessageKey.String(err.Error()))
+
+		if !policy.retryable(err) {
+			outcome = retryOutcomeNotRetryable
+		} else if attempt >= policy.attempts() {
+			outcome = retryOutcomeExhausted
+		}
+		if outcome != retryOutcomeSucceeded {
+			span.AddEvent(retryAttemptEvent, trace.WithAttributes(attrs...))
+			break
+		}
+
+		backoff := policy.backoff(attempt)
+		attrs = append(attrs, messagingKafkaRetryBackoffKey.Int64(backoff.Milliseconds()))
+		span.AddEvent(retryAttemptEvent, trace.WithAttributes(attrs...))
+		if waitErr := wait(ctx, backoff); waitErr != nil {
+			outcome, err = retryOutcomeCancelled, waitErr
+			break
+		}
+	}
+
+	span.SetAttributes(
+		messagingKafkaRetryCountKey.Int(attempt-1),
+		messagingKafkaRetryOutcomeKey.String(outcome),
+	)
+	if owned {
+		recordError(span, err)
+	} else {
+		endSpan(span, err)
+	}
+	return msg, span.SpanContext(), err
+}
+
+// wait blocks for d, or until ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,169 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	// Given
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+
+	// When
+	got := []time.Duration{p.backoff(1), p.backoff(2), p.backoff(3), p.backoff(100)}
+
+	// Then
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second}, got)
+	assert.Equal(t, 1, RetryPolicy{}.attempts())
+}
+
+func TestReaderHandleMessageRetries(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	var retryCounts []string
+
+	// When
+	err := r.HandleMessage(context.Background(), kafka.Message{Topic: "orders"}, func(_ context.Context, msg kafka.Message) error {
+		retryCounts = append(retryCounts, NewMessageCarrier(&msg).Get(RetryCountHeader))
+		if len(retryCounts) < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "1", "2"}, retryCounts)
+	consumed := spansByName(sr.Ended(), "process orders")
+	if !assert.Len(t, consumed, 1) {
+		return
+	}
+	assert.Equal(t, codes.Unset, consumed[0].Status().Code)
+	assert.Contains(t, consumed[0].Attributes(), messagingKafkaRetryCountKey.Int(2))
+	assert.Contains(t, consumed[0].Attributes(), messagingKafkaRetryOutcomeKey.String(retryOutcomeSucceeded))
+	if events := consumed[0].Events(); assert.Len(t, events, 3) {
+		for i, e := range events {
+			assert.Equal(t, retryAttemptEvent, e.Name)
+			assert.Contains(t, e.Attributes, messagingKafkaRetryAttemptKey.Int(i+1))
+		}
+	}
+}
+
+func TestReaderHandleMessageStopsOnNonRetryableError(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	permanent := errors.New("permanent")
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: 5,
+			Retryable:   func(err error) bool { return !errors.Is(err, permanent) },
+		}),
+	)
+	calls := 0
+
+	// When
+	err := r.HandleMessage(context.Background(), kafka.Message{Topic: "orders"}, func(context.Context, kafka.Message) error {
+		calls++
+		return permanent
+	})
+
+	// Then
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, 1, calls)
+	if consumed := spansByName(sr.Ended(), "process orders"); assert.Len(t, consumed, 1) {
+		assert.Equal(t, codes.Error, consumed[0].Status().Code)
+		assert.Contains(t, consumed[0].Attributes(), messagingKafkaRetryOutcomeKey.String(retryOutcomeNotRetryable))
+	}
+}
+
+func TestReaderHandleMessageExhaustsAttempts(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+	)
+	calls := 0
+
+	// When
+	err := r.HandleMessage(context.Background(), kafka.Message{Topic: "orders"}, func(context.Context, kafka.Message) error {
+		calls++
+		return errors.New("transient")
+	})
+
+	// Then
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls)
+	if consumed := spansByName(sr.Ended(), "process orders"); assert.Len(t, consumed, 1) {
+		assert.Contains(t, consumed[0].Attributes(), messagingKafkaRetryCountKey.Int(1))
+		assert.Contains(t, consumed[0].Attributes(), messagingKafkaRetryOutcomeKey.String(retryOutcomeExhausted))
+	}
+}
+
+func TestReaderHandleMessageLeavesOwnedSpanOpen(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	r, _ := newFetchingReader(t, []kafka.Message{{Topic: "orders", Offset: 3}},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+	)
+	msg := fetchMessage(t, r)
+
+	// When
+	err := r.HandleMessage(context.Background(), msg, func(context.Context, kafka.Message) error {
+		return errors.New("failed")
+	})
+	open := r.MessageSpan(msg)
+	recording := open.IsRecording()
+	r.EndMessageSpan(msg, nil)
+
+	// Then
+	assert.Error(t, err)
+	assert.True(t, recording)
+	if process := spansByName(sr.Ended(), "process orders"); assert.Len(t, process, 1) {
+		assert.Equal(t, open.SpanContext(), process[0].SpanContext())
+		assert.Equal(t, codes.Error, process[0].Status().Code)
+		assert.Len(t, process[0].Events(), 2)
+	}
+	assert.False(t, r.MessageSpan(msg).SpanContext().IsValid())
+}
+
+func TestReaderHandleMessageLeavesCallerHeadersUnchanged(t *testing.T) {
+	// Given
+	r := newTestReader(t,
+		WithTracerProvider(sdktrace.NewTracerProvider()),
+		WithPropagator(propagation.TraceContext{}),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+	)
+	// The spare capacity would be written to by appended headers.
+	headers := make([]kafka.Header, 1, 4)
+	headers[0] = kafka.Header{Key: RetryCountHeader, Value: []byte("0")}
+	want := append([]kafka.Header(nil), headers[:cap(headers)]...)
+	msg := kafka.Message{Topic: "orders", Headers: headers}
+	var handled []kafka.Header
+
+	// When
+	err := r.HandleMessage(context.Background(), msg, func(_ context.Context, msg kafka.Message) error {
+		handled = msg.Headers
+		return errors.New("transient")
+	})
+
+	// Then
+	assert.Error(t, err)
+	assert.Equal(t, want, headers[:cap(headers)])
+	assert.Equal(t, "1", NewMessageCarrier(&kafka.Message{Headers: handled}).Get(RetryCountHeader))
+	assert.NotEmpty(t, NewMessageCarrier(&kafka.Message{Headers: handled}).Get("traceparent"))
+}
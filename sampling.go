@@ -0,0 +1,91 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"crypto/rand"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplingDecision is what a MessageSampler decides for the span of a
+// message.
+type SamplingDecision int
+
+const (
+	// SamplingDefault leaves the decision to the sampler of the
+	// TracerProvider.
+	SamplingDefault SamplingDecision = iota
+	// SamplingDrop starts no span. The context the span would have been
+	// started from keeps being propagated.
+	SamplingDrop
+	// SamplingNonRecording starts a span that is neither recorded nor
+	// sampled, so the services downstream do not sample it either.
+	SamplingNonRecording
+	// SamplingForce records and samples the span, provided the sampler of
+	// the TracerProvider is wrapped with forcesampler.New. It is a no-op
+	// otherwise, leaving the decision to that sampler.
+	SamplingForce
+)
+
+// MessageSampler decides, before a span of operation about msg is started,
+// whether it is sampled. Spans covering several messages get the message
+// described on Config.SpanNameFormatter.
+type MessageSampler func(operation string, msg *kafka.Message) SamplingDecision
+
+// forceSamplingKey marks the contexts spans are started from when a
+// MessageSampler forces them to be sampled.
+type forceSamplingKey struct{}
+
+// SamplingForced reports whether a MessageSampler forced the span started
+// from ctx to be sampled. Samplers call it with the parent context of the
+// span they decide on, as forcesampler.New does.
+func SamplingForced(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(forceSamplingKey{}) != nil
+}
+
+// startSpan starts the span of operation about msg from ctx, as the
+// MessageSampler of c decides.
+func (c *Config) startSpan(ctx context.Context, operation string, msg *kafka.Message, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	decision := SamplingDefault
+	if c.MessageSampler != nil {
+		decision = c.MessageSampler(operation, msg)
+	}
+
+	switch decision {
+	case SamplingDrop:
+		return passThroughSpan(ctx)
+	case SamplingNonRecording:
+		ctx = trace.ContextWithSpanContext(ctx, nonRecordingSpanContext(trace.SpanContextFromContext(ctx)))
+		return ctx, trace.SpanFromContext(ctx)
+	case SamplingForce:
+		ctx = context.WithValue(ctx, forceSamplingKey{}, true)
+	}
+	return c.Tracer.Start(ctx, c.SpanNameFormatter(operation, msg), opts...)
+}
+
+// passThroughSpan returns a copy of ctx holding a non-recording span with the
+// span context of ctx, for the spans that are not started. The span context
+// is wrapped, so ending the returned span never ends a span of the caller.
+func passThroughSpan(ctx context.Context) (context.Context, trace.Span) {
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(ctx))
+	return ctx, trace.SpanFromContext(ctx)
+}
+
+// nonRecordingSpanContext returns a new unsampled span context, child of
+// parent if it is valid.
+func nonRecordingSpanContext(parent trace.SpanContext) trace.SpanContext {
+	traceID := parent.TraceID()
+	if !traceID.IsValid() {
+		_, _ = rand.Read(traceID[:])
+	}
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: parent.TraceFlags().WithSampled(false),
+		TraceState: parent.TraceState(),
+	})
+}
@@ -0,0 +1,88 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newSamplingConfig(sampler sdktrace.Sampler, decision SamplingDecision) (*Config, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithSampler(sampler))
+	return NewConfig(instrumentationName,
+		WithTracerProvider(tp),
+		WithMessageSampler(func(string, *kafka.Message) SamplingDecision { return decision }),
+	), sr
+}
+
+func TestConfigStartSpanDrop(t *testing.T) {
+	// Given
+	cfg, sr := newSamplingConfig(sdktrace.AlwaysSample(), SamplingDrop)
+	parentCtx, parent := cfg.Tracer.Start(context.Background(), "parent")
+
+	// When
+	ctx, span := cfg.startSpan(parentCtx, operationPublish, &kafka.Message{Topic: "orders"})
+	span.End()
+
+	// Then
+	assert.False(t, span.IsRecording())
+	assert.Equal(t, parent.SpanContext(), trace.SpanContextFromContext(ctx))
+	assert.True(t, parent.IsRecording())
+	assert.Empty(t, sr.Ended())
+}
+
+func TestConfigStartSpanNonRecording(t *testing.T) {
+	// Given
+	cfg, sr := newSamplingConfig(sdktrace.AlwaysSample(), SamplingNonRecording)
+	parentCtx, parent := cfg.Tracer.Start(context.Background(), "parent")
+
+	// When
+	ctx, span := cfg.startSpan(parentCtx, operationPublish, &kafka.Message{Topic: "orders"})
+	span.End()
+
+	// Then
+	sc := trace.SpanContextFromContext(ctx)
+	assert.False(t, span.IsRecording())
+	assert.Equal(t, parent.SpanContext().TraceID(), sc.TraceID())
+	assert.NotEqual(t, parent.SpanContext().SpanID(), sc.SpanID())
+	assert.True(t, sc.SpanID().IsValid())
+	assert.False(t, sc.IsSampled())
+	assert.Empty(t, sr.Ended())
+}
+
+// parentRecorder is a sampler recording the parent context of the last span
+// it decided on.
+type parentRecorder struct {
+	parent context.Context
+}
+
+func (p *parentRecorder) ShouldSample(params sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	p.parent = params.ParentContext
+	return sdktrace.AlwaysSample().ShouldSample(params)
+}
+
+func (p *parentRecorder) Description() string {
+	return "parentRecorder"
+}
+
+func TestConfigStartSpanForce(t *testing.T) {
+	// Given
+	sampler := &parentRecorder{}
+	cfg, _ := newSamplingConfig(sampler, SamplingForce)
+
+	// When
+	_, span := cfg.startSpan(context.Background(), operationReceive, &kafka.Message{Topic: "orders"})
+	span.End()
+	forced := SamplingForced(sampler.parent)
+	_, unmarked := cfg.Tracer.Start(context.Background(), "unmarked")
+	unmarked.End()
+
+	// Then
+	assert.True(t, forced)
+	assert.False(t, SamplingForced(sampler.parent))
+}
@@ -0,0 +1,125 @@
+package otelkafkakonsumer
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv113 "go.opentelemetry.io/otel/semconv/v1.13.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+// Operation types used as the value of the messaging.operation.type
+// attribute of spans and metrics.
+const (
+	operationCreate  = "create"
+	operationPublish = "publish"
+	operationReceive = "receive"
+	operationProcess = "process"
+	operationSettle  = "settle"
+)
+
+// DefaultSpanNameFormatter names spans "{operation} {destination}", following
+// the messaging conventions, e.g. "publish orders". Spans of several topics
+// are named after their operation only.
+func DefaultSpanNameFormatter(operation string, msg *kafka.Message) string {
+	if msg == nil || msg.Topic == "" {
+		return operation
+	}
+	return operation + " " + msg.Topic
+}
+
+// messageAttributes returns the attributes describing msg on a span of
+// operation, including the legacy ones when c is configured with them. The
+// key of msg is recorded as c's KeyPolicy decides.
+func (c *Config) messageAttributes(operation string, msg *kafka.Message) []attribute.KeyValue {
+	key, hasKey := c.KeyPolicy(msg.Key)
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingOperationTypeKey.String(operation),
+		semconv.MessagingDestinationName(msg.Topic),
+	}
+	if hasKey {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(key))
+	}
+	if c.LegacyAttributes {
+		attrs = append(attrs,
+			semconv113.MessagingDestinationKindTopic,
+			semconv113.MessagingDestinationKey.String(msg.Topic),
+		)
+		if hasKey {
+			attrs = append(attrs, semconv113.MessagingKafkaMessageKeyKey.String(key))
+		}
+		switch operation {
+		case operationReceive, operationSettle:
+			attrs = append(attrs, semconv113.MessagingOperationReceive)
+		case operationProcess:
+			attrs = append(attrs, semconv113.MessagingOperationProcess)
+		}
+	}
+	return attrs
+}
+
+// positionAttributes returns the attributes describing the partition and
+// offset of msg, including the legacy ones when c is configured with them.
+// Outgoing messages only have a position once they are delivered.
+func (c *Config) positionAttributes(msg *kafka.Message) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+		semconv.MessagingKafkaOffset(int(msg.Offset)),
+	}
+	if c.LegacyAttributes {
+		attrs = append(attrs,
+			semconv113.MessagingMessageIDKey.String(strconv.FormatInt(msg.Offset, 10)),
+			semconv113.MessagingKafkaPartitionKey.Int64(int64(msg.Partition)),
+		)
+	}
+	return attrs
+}
+
+// connectionAttributes returns the attributes identifying a client with
+// clientID, in consumer group groupID, connected to brokers. The server
+// address is that of the first broker. Empty values are left out.
+func connectionAttributes(groupID, clientID string, brokers []string) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if groupID != "" {
+		attrs = append(attrs, semconv.MessagingConsumerGroupName(groupID))
+	}
+	if clientID != "" {
+		attrs = append(attrs, semconv.MessagingClientID(clientID))
+	}
+	if len(brokers) > 0 && brokers[0] != "" {
+		host, port, err := net.SplitHostPort(brokers[0])
+		if err != nil {
+			host, port = brokers[0], ""
+		}
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(p))
+		}
+	}
+	return attrs
+}
+
+// readerConnectionAttributes returns the connection attributes of r, taken
+// from its configuration.
+func readerConnectionAttributes(r *kafka.Reader) []attribute.KeyValue {
+	cfg := r.Config()
+	var clientID string
+	if cfg.Dialer != nil {
+		clientID = cfg.Dialer.ClientID
+	}
+	return connectionAttributes(cfg.GroupID, clientID, cfg.Brokers)
+}
+
+// writerConnectionAttributes returns the connection attributes of w, taken
+// from its address and transport.
+func writerConnectionAttributes(w *kafka.Writer) []attribute.KeyValue {
+	var brokers []string
+	if w.Addr != nil {
+		brokers = strings.Split(w.Addr.String(), ",")
+	}
+	return connectionAttributes("", writerClientID(w), brokers)
+}
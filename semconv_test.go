@@ -0,0 +1,59 @@
+package otelkafkakonsumer
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv113 "go.opentelemetry.io/otel/semconv/v1.13.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+func TestDefaultSpanNameFormatter(t *testing.T) {
+	assert.Equal(t, "publish orders", DefaultSpanNameFormatter(operationPublish, &kafka.Message{Topic: "orders"}))
+	assert.Equal(t, "settle", DefaultSpanNameFormatter(operationSettle, &kafka.Message{}))
+	assert.Equal(t, "settle", DefaultSpanNameFormatter(operationSettle, nil))
+}
+
+func TestConfigMessageAttributes(t *testing.T) {
+	// Given
+	msg := &kafka.Message{Topic: "orders", Partition: 2, Offset: 42, Key: []byte("key")}
+	stable := NewConfig(instrumentationName)
+	legacy := NewConfig(instrumentationName, WithLegacyAttributes())
+
+	// When
+	stableAttrs := append(stable.messageAttributes(operationProcess, msg), stable.positionAttributes(msg)...)
+	legacyAttrs := append(legacy.messageAttributes(operationProcess, msg), legacy.positionAttributes(msg)...)
+
+	// Then
+	want := []attribute.KeyValue{
+		semconv.MessagingOperationTypeProcess,
+		semconv.MessagingDestinationName("orders"),
+		semconv.MessagingDestinationPartitionID("2"),
+		semconv.MessagingKafkaOffset(42),
+		semconv.MessagingKafkaMessageKey("key"),
+	}
+	assert.ElementsMatch(t, want, stableAttrs)
+	assert.ElementsMatch(t, append(want,
+		semconv113.MessagingDestinationKindTopic,
+		semconv113.MessagingDestinationKey.String("orders"),
+		semconv113.MessagingMessageIDKey.String("42"),
+		semconv113.MessagingKafkaMessageKeyKey.String("key"),
+		semconv113.MessagingKafkaPartitionKey.Int64(2),
+		semconv113.MessagingOperationProcess,
+	), legacyAttrs)
+}
+
+func TestConnectionAttributes(t *testing.T) {
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.MessagingConsumerGroupName("orders-cg"),
+		semconv.MessagingClientID("orders-service"),
+		semconv.ServerAddress("broker-1"),
+		semconv.ServerPort(9092),
+	}, connectionAttributes("orders-cg", "orders-service", []string{"broker-1:9092", "broker-2:9092"}))
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.ServerAddress("broker-1"),
+	}, connectionAttributes("", "", []string{"broker-1"}))
+	assert.Empty(t, connectionAttributes("", "", nil))
+}
@@ -0,0 +1,187 @@
+package otelkafkakonsumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultAbandonedSpanTimeout is how long a fetched message span stays open
+// when no other AbandonedSpanTimeout is configured. It matches the default
+// max.poll.interval.ms of Kafka consumers.
+const DefaultAbandonedSpanTimeout = 5 * time.Minute
+
+// abandonedStatus is the status description of spans ended because their
+// message was neither committed nor explicitly ended in time.
+const abandonedStatus = "abandoned"
+
+// messagingKafkaAbandonedKey marks spans that ended as abandoned.
+var messagingKafkaAbandonedKey = attribute.Key("messaging.kafka.abandoned")
+
+// messageKey identifies a fetched message by its position in a partition.
+type messageKey struct {
+	topic     string
+	partition int
+	offset    int64
+}
+
+func keyOf(msg *kafka.Message) messageKey {
+	return messageKey{topic: msg.Topic, partition: msg.Partition, offset: msg.Offset}
+}
+
+// spanEntry is an open span along with the timer abandoning it.
+type spanEntry struct {
+	span  trace.Span
+	timer *time.Timer
+}
+
+// spanRegistry holds the open span of every fetched message until the span
+// is ended. It is safe for concurrent use.
+//
+// When timeout is positive, spans that are still open after timeout are
+// removed and ended with the abandoned status.
+type spanRegistry struct {
+	mu      sync.Mutex
+	spans   map[messageKey]*spanEntry
+	timeout time.Duration
+}
+
+func newSpanRegistry(timeout time.Duration) *spanRegistry {
+	return &spanRegistry{spans: make(map[messageKey]*spanEntry), timeout: timeout}
+}
+
+// add stores span as the open span of msg. A span already stored for the same
+// message, e.g. when it is fetched again after a rebalance, is ended.
+func (s *spanRegistry) add(msg *kafka.Message, span trace.Span) {
+	key := keyOf(msg)
+	entry := &spanEntry{span: span}
+
+	s.mu.Lock()
+	previous, ok := s.spans[key]
+	s.spans[key] = entry
+	if s.timeout > 0 {
+		entry.timer = time.AfterFunc(s.timeout, func() { s.abandon(key, entry) })
+	}
+	s.mu.Unlock()
+
+	if ok {
+		previous.stop()
+		previous.span.End()
+	}
+}
+
+// abandon ends entry with the abandoned status if it is still the open span
+// of key.
+func (s *spanRegistry) abandon(key messageKey, entry *spanEntry) {
+	s.mu.Lock()
+	if s.spans[key] != entry {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.spans, key)
+	s.mu.Unlock()
+
+	entry.span.SetAttributes(messagingKafkaAbandonedKey.Bool(true))
+	entry.span.SetStatus(codes.Error, abandonedStatus)
+	entry.span.End()
+}
+
+// get returns the open span of msg.
+func (s *spanRegistry) get(msg *kafka.Message) (trace.Span, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.spans[keyOf(msg)]
+	if !ok {
+		return nil, false
+	}
+	return entry.span, true
+}
+
+// remove returns the open span of msg and stops holding it.
+func (s *spanRegistry) remove(msg *kafka.Message) (trace.Span, bool) {
+	s.mu.Lock()
+	entry, ok := s.spans[keyOf(msg)]
+	delete(s.spans, keyOf(msg))
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	entry.stop()
+	return entry.span, true
+}
+
+// removeAll returns every open span and stops holding them.
+func (s *spanRegistry) removeAll() []trace.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]trace.Span, 0, len(s.spans))
+	for key, entry := range s.spans {
+		entry.stop()
+		out = append(out, entry.span)
+		delete(s.spans, key)
+	}
+	return out
+}
+
+func (e *spanEntry) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+// partitionKey identifies a partition of a topic.
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// receipt is the receive span context of the message read at offset.
+type receipt struct {
+	offset int64
+	sc     trace.SpanContext
+}
+
+// receiptRegistry holds the receive span context of the last message read
+// from every partition, so the process span of a message read without being
+// fetched can link to it. It is safe for concurrent use, and holds at most
+// one span context per partition.
+type receiptRegistry struct {
+	mu       sync.Mutex
+	receipts map[partitionKey]receipt
+}
+
+func newReceiptRegistry() *receiptRegistry {
+	return &receiptRegistry{receipts: make(map[partitionKey]receipt)}
+}
+
+// add stores sc as the receive span context of msg, in place of that of the
+// message read before it from the same partition.
+func (s *receiptRegistry) add(msg *kafka.Message, sc trace.SpanContext) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.receipts[partitionKey{topic: msg.Topic, partition: msg.Partition}] = receipt{offset: msg.Offset, sc: sc}
+}
+
+// remove returns the receive span context of msg, if it is still the last
+// message read from its partition, and stops holding it.
+func (s *receiptRegistry) remove(msg *kafka.Message) (trace.SpanContext, bool) {
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.receipts[key]
+	if !ok || r.offset != msg.Offset {
+		return trace.SpanContext{}, false
+	}
+	delete(s.receipts, key)
+	return r.sc, true
+}
@@ -0,0 +1,101 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpanRegistryAddEndsReplacedSpan(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	registry := newSpanRegistry(0)
+	msg := &kafka.Message{Topic: "orders", Partition: 1, Offset: 7}
+	_, first := tracer.Start(context.Background(), "first")
+	_, second := tracer.Start(context.Background(), "second")
+
+	// When
+	registry.add(msg, first)
+	registry.add(msg, second)
+
+	// Then
+	if assert.Len(t, sr.Ended(), 1) {
+		assert.Equal(t, "first", sr.Ended()[0].Name())
+	}
+	got, ok := registry.get(msg)
+	assert.True(t, ok)
+	assert.Equal(t, second, got)
+}
+
+func TestSpanRegistryConcurrentUse(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	registry := newSpanRegistry(0)
+	const goroutines, perGoroutine = 32, 100
+
+	// When
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(partition int) {
+			defer wg.Done()
+			for offset := 0; offset < perGoroutine; offset++ {
+				msg := &kafka.Message{Topic: "orders", Partition: partition, Offset: int64(offset)}
+				_, span := tracer.Start(context.Background(), "fetched")
+				registry.add(msg, span)
+				if got, ok := registry.get(msg); assert.True(t, ok) {
+					assert.Equal(t, span, got)
+				}
+				if got, ok := registry.remove(msg); assert.True(t, ok) {
+					got.End()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Then
+	assert.Len(t, sr.Ended(), goroutines*perGoroutine)
+	assert.Empty(t, registry.removeAll())
+}
+
+func TestSpanRegistryAbandonsExpiredSpans(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	registry := newSpanRegistry(10 * time.Millisecond)
+	expired := &kafka.Message{Topic: "orders", Offset: 1}
+	ended := &kafka.Message{Topic: "orders", Offset: 2}
+	_, expiredSpan := tracer.Start(context.Background(), "expired")
+	_, endedSpan := tracer.Start(context.Background(), "ended")
+
+	// When
+	registry.add(expired, expiredSpan)
+	registry.add(ended, endedSpan)
+	if span, ok := registry.remove(ended); assert.True(t, ok) {
+		span.End()
+	}
+
+	// Then
+	assert.Eventually(t, func() bool { return len(sr.Ended()) == 2 }, time.Second, time.Millisecond)
+	for _, s := range sr.Ended() {
+		if s.Name() == "expired" {
+			assert.Equal(t, codes.Error, s.Status().Code)
+			assert.Equal(t, abandonedStatus, s.Status().Description)
+			assert.Contains(t, s.Attributes(), messagingKafkaAbandonedKey.Bool(true))
+		} else {
+			assert.Equal(t, codes.Unset, s.Status().Code)
+		}
+	}
+	_, ok := registry.get(expired)
+	assert.False(t, ok)
+}
@@ -0,0 +1,167 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	metricClientIDKey = attribute.Key("messaging.client.id")
+
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// statsField mirrors one field of kafka.ReaderStats or kafka.WriterStats as
+// an asynchronous instrument named after the field's metric struct tag.
+type statsField struct {
+	index    []int
+	counter  bool
+	duration bool
+
+	intInstrument   metric.Int64Observable
+	floatInstrument metric.Float64Observable
+
+	// kafka-go resets counters on every Stats call, so counters are
+	// accumulated here to be reported as cumulative sums.
+	intTotal   int64
+	floatTotal float64
+}
+
+// statsObserver reports the snapshots returned by a Stats method through
+// asynchronous instruments during collection.
+type statsObserver struct {
+	mu           sync.Mutex
+	fields       []*statsField
+	registration metric.Registration
+}
+
+// newStatsObserver creates an instrument for every metric tagged field of the
+// stats struct type t and registers a callback calling snapshot on every
+// collection. snapshot returns the stats value and the attributes to observe
+// it with.
+//
+// Because kafka-go resets its counters whenever Stats is called, calling the
+// Stats method elsewhere makes the reported counters miss those values.
+func newStatsObserver(meter metric.Meter, t reflect.Type, snapshot func() (reflect.Value, []attribute.KeyValue)) *statsObserver {
+	s := &statsObserver{}
+
+	var errs []error
+	s.addFields(meter, t, "", nil, &errs)
+
+	instruments := make([]metric.Observable, 0, len(s.fields))
+	for _, f := range s.fields {
+		if f.duration {
+			instruments = append(instruments, f.floatInstrument)
+		} else {
+			instruments = append(instruments, f.intInstrument)
+		}
+	}
+
+	registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		v, attrs := snapshot()
+		s.observe(o, v, metric.WithAttributes(attrs...))
+		return nil
+	}, instruments...)
+	errs = append(errs, err)
+	s.registration = registration
+
+	if err := errors.Join(errs...); err != nil {
+		otel.Handle(err)
+	}
+	return s
+}
+
+func (s *statsObserver) addFields(meter metric.Meter, t reflect.Type, prefix string, index []int, errs *[]error) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("metric")
+		// Skip untagged fields and the misspelled duplicate of the fetch count.
+		if name == "" || strings.HasPrefix(name, "kafak.") {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if f.Type.Kind() == reflect.Struct {
+			s.addFields(meter, f.Type, name, fieldIndex, errs)
+			continue
+		}
+
+		sf := &statsField{
+			index:    fieldIndex,
+			counter:  f.Tag.Get("type") == "counter",
+			duration: f.Type == durationType,
+		}
+
+		var err error
+		switch {
+		case sf.duration && sf.counter:
+			sf.floatInstrument, err = meter.Float64ObservableCounter(name, metric.WithUnit("s"))
+		case sf.duration:
+			sf.floatInstrument, err = meter.Float64ObservableGauge(name, metric.WithUnit("s"))
+		case sf.counter:
+			sf.intInstrument, err = meter.Int64ObservableCounter(name)
+		default:
+			sf.intInstrument, err = meter.Int64ObservableGauge(name)
+		}
+		if err != nil {
+			*errs = append(*errs, err)
+			continue
+		}
+		s.fields = append(s.fields, sf)
+	}
+}
+
+func (s *statsObserver) observe(o metric.Observer, v reflect.Value, opt metric.ObserveOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.fields {
+		fv := v.FieldByIndex(f.index)
+
+		if f.duration {
+			seconds := time.Duration(fv.Int()).Seconds()
+			if f.counter {
+				f.floatTotal += seconds
+				seconds = f.floatTotal
+			}
+			o.ObserveFloat64(f.floatInstrument, seconds, opt)
+			continue
+		}
+
+		var value int64
+		if fv.Kind() == reflect.Bool {
+			if fv.Bool() {
+				value = 1
+			}
+		} else {
+			value = fv.Int()
+		}
+		if f.counter {
+			f.intTotal += value
+			value = f.intTotal
+		}
+		o.ObserveInt64(f.intInstrument, value, opt)
+	}
+}
+
+// unregister stops reporting the stats, if s reports any. Errors are
+// reported to the global OpenTelemetry error handler.
+func (s *statsObserver) unregister() {
+	if s == nil || s.registration == nil {
+		return
+	}
+	if err := s.registration.Unregister(); err != nil {
+		otel.Handle(err)
+	}
+}
@@ -0,0 +1,107 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+)
+
+// collectStats returns the aggregations of the stats instruments reader
+// collects, by name.
+func collectStats(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if strings.HasPrefix(m.Name, "kafka.") {
+				got[m.Name] = m.Data
+			}
+		}
+	}
+	return got
+}
+
+func TestReaderReportsStats(t *testing.T) {
+	// Given
+	reader := sdkmetric.NewManualReader()
+	r := newTestReader(t, WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	attrs := attribute.NewSet(
+		metricClientIDKey.String(r.R.Stats().ClientID),
+		metricTopicKey.String("orders"),
+		metricPartitionKey.String("0"),
+	)
+
+	// When
+	got := collectStats(t, reader)
+
+	// Then
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Gauge[int64]{
+		DataPoints: []metricdata.DataPoint[int64]{{Attributes: attrs, Value: 100}},
+	}, got["kafka.reader.queue.capacity"], metricdatatest.IgnoreTimestamp())
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints:  []metricdata.DataPoint[int64]{{Attributes: attrs, Value: 0}},
+	}, got["kafka.reader.fetch.count"], metricdatatest.IgnoreTimestamp())
+	assert.Contains(t, got, "kafka.reader.lag")
+	assert.Contains(t, got, "kafka.reader.wait.seconds.avg")
+	assert.NotContains(t, got, "kafak.reader.fetch.count")
+}
+
+func TestStatsNotReportedAfterClose(t *testing.T) {
+	// Given
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	r, err := NewReader(kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "orders",
+	}), WithMeterProvider(mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Topic:        "orders",
+		Transport:    &fakeTransport{},
+		BatchTimeout: time.Millisecond,
+	}, WithMeterProvider(mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := collectStats(t, reader)
+
+	// When
+	_ = r.Close()
+	_ = w.Close()
+
+	// Then
+	assert.Contains(t, before, "kafka.reader.queue.capacity")
+	assert.Contains(t, before, "kafka.writer.message.count")
+	for name, data := range collectStats(t, reader) {
+		switch data := data.(type) {
+		case metricdata.Gauge[int64]:
+			assert.Empty(t, data.DataPoints, name)
+		case metricdata.Gauge[float64]:
+			assert.Empty(t, data.DataPoints, name)
+		case metricdata.Sum[int64]:
+			assert.Empty(t, data.DataPoints, name)
+		case metricdata.Sum[float64]:
+			assert.Empty(t, data.DataPoints, name)
+		default:
+			t.Errorf("%s: unexpected aggregation %T", name, data)
+		}
+	}
+}
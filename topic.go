@@ -0,0 +1,38 @@
+package otelkafkakonsumer
+
+import "regexp"
+
+// TopicFilter reports whether the messages of topic are traced. The messages
+// of the topics it filters out get no span, and no trace context is injected
+// into their headers.
+type TopicFilter func(topic string) bool
+
+// TopicsMatching returns a TopicFilter tracing only the topics matching any
+// of res.
+func TopicsMatching(res ...*regexp.Regexp) TopicFilter {
+	return func(topic string) bool {
+		return matchesAny(res, topic)
+	}
+}
+
+// TopicsNotMatching returns a TopicFilter tracing only the topics matching
+// none of res, e.g. internal or retry topics.
+func TopicsNotMatching(res ...*regexp.Regexp) TopicFilter {
+	return func(topic string) bool {
+		return !matchesAny(res, topic)
+	}
+}
+
+func matchesAny(res []*regexp.Regexp, topic string) bool {
+	for _, re := range res {
+		if re.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// traces reports whether c traces the messages of topic.
+func (c *Config) traces(topic string) bool {
+	return c.TopicFilter == nil || c.TopicFilter(topic)
+}
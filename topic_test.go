@@ -0,0 +1,40 @@
+package otelkafkakonsumer
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicsMatching(t *testing.T) {
+	// Given
+	filter := TopicsMatching(regexp.MustCompile(`^orders\.`), regexp.MustCompile(`^payments$`))
+
+	// When
+	// Then
+	assert.True(t, filter("orders.created"))
+	assert.True(t, filter("payments"))
+	assert.False(t, filter("payments.retry"))
+	assert.False(t, filter("__consumer_offsets"))
+}
+
+func TestTopicsNotMatching(t *testing.T) {
+	// Given
+	filter := TopicsNotMatching(regexp.MustCompile(`^__`), regexp.MustCompile(`\.retry$`))
+
+	// When
+	// Then
+	assert.True(t, filter("orders"))
+	assert.False(t, filter("__consumer_offsets"))
+	assert.False(t, filter("orders.retry"))
+}
+
+func TestConfigTracesEveryTopicWithoutFilter(t *testing.T) {
+	// Given
+	c := NewConfig(instrumentationName)
+
+	// When
+	// Then
+	assert.True(t, c.traces("orders"))
+}
@@ -2,74 +2,322 @@ package otelkafkakonsumer
 
 import (
 	"context"
-	"fmt"
-	"strconv"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	semconv "go.opentelemetry.io/otel/semconv/v1.16.0"
+	semconv113 "go.opentelemetry.io/otel/semconv/v1.13.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// messagingKafkaBatchTopicsKey lists the distinct topics of the messages
+// covered by a single batch span.
+var messagingKafkaBatchTopicsKey = attribute.Key("messaging.kafka.batch.topics")
+
 type Writer struct {
 	W           *kafka.Writer
 	TraceConfig *Config
+	metrics     *messagingMetrics
+	stats       *statsObserver
+	deliveries  *deliveryTracker
 }
 
-// NewWriter wraps the resulting Writer with OpenTelemetry instrumentation
+// NewWriter wraps the resulting Writer with OpenTelemetry instrumentation.
+//
+// It chains onto w.Completion, which keeps being called, to learn the
+// partition and offset of every delivered message, so w.Completion must not
+// be replaced afterwards. w may be nil, in which case no connection
+// attributes nor stats are recorded.
 func NewWriter(w *kafka.Writer, opts ...Option) (*Writer, error) {
 	cfg := NewConfig(instrumentationName, opts...)
 
-	// Common attributes for all spans this producer will produce.
+	// Common attributes for all spans this producer will produce. They come
+	// first, so the attributes set with options take precedence.
+	attrs := []attribute.KeyValue{semconv.MessagingSystemKafka}
+	if !cfg.OmitConnectionAttributes && w != nil {
+		attrs = append(attrs, writerConnectionAttributes(w)...)
+	}
 	cfg.DefaultStartOpts = append(
-		cfg.DefaultStartOpts,
-		trace.WithAttributes(
-			semconv.MessagingDestinationKindTopic,
-		),
+		[]trace.SpanStartOption{trace.WithAttributes(attrs...)},
+		cfg.DefaultStartOpts...,
 	)
 
-	return &Writer{
+	writer := &Writer{
 		W:           w,
 		TraceConfig: cfg,
-	}, nil
+		metrics:     newMessagingMetrics(cfg.Meter),
+		deliveries:  newDeliveryTracker(cfg),
+	}
+	if w == nil {
+		return writer, nil
+	}
+	writer.stats = newStatsObserver(cfg.Meter, reflect.TypeOf(kafka.WriterStats{}), writerStats(w))
+
+	completion := w.Completion
+	w.Completion = func(messages []kafka.Message, err error) {
+		writer.deliveries.completion(messages, err)
+		writer.recordDelivery(messages, err)
+		if completion != nil {
+			completion(messages, err)
+		}
+	}
+
+	return writer, nil
+}
+
+// recordDelivery records the messages of a delivery report in the publish
+// metrics, with the partition Kafka assigned to them. Failed deliveries are
+// recorded here only for asynchronous writes, as synchronous ones return
+// their error to write.
+func (w *Writer) recordDelivery(msgs []kafka.Message, err error) {
+	ctx := context.Background()
+	for i := range msgs {
+		topic := w.topic(&msgs[i])
+		switch {
+		case err == nil:
+			w.metrics.recordDelivered(ctx, topic, &msgs[i])
+		case w.W.Async:
+			w.metrics.recordPublishError(ctx, topic)
+		}
+	}
 }
 
+// writerStats returns a snapshot func of w's stats for newStatsObserver.
+func writerStats(w *kafka.Writer) func() (reflect.Value, []attribute.KeyValue) {
+	clientID := writerClientID(w)
+	return func() (reflect.Value, []attribute.KeyValue) {
+		stats := w.Stats()
+		return reflect.ValueOf(stats), []attribute.KeyValue{
+			metricClientIDKey.String(clientID),
+			metricTopicKey.String(stats.Topic),
+		}
+	}
+}
+
+// writerClientID returns the client ID w's transport identifies itself with.
+func writerClientID(w *kafka.Writer) string {
+	if t, ok := w.Transport.(*kafka.Transport); ok {
+		return t.ClientID
+	}
+	return ""
+}
+
+// Close calls the underlying Writer.Close, stops reporting its stats and ends
+// the spans of asynchronous writes whose delivery was never reported.
 func (w *Writer) Close() error {
-	return w.W.Close()
+	err := w.W.Close()
+	w.stats.unregister()
+	w.deliveries.flush()
+	return err
 }
 
 func (w *Writer) WriteMessage(ctx context.Context, msg kafka.Message) error {
-	span := w.startSpan(ctx, &msg)
-	err := w.W.WriteMessages(ctx, msg)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
+	return w.writeMessage(ctx, msg)
+}
+
+// writeMessage implements WriteMessage, starting the message span with
+// extraOpts.
+func (w *Writer) writeMessage(ctx context.Context, msg kafka.Message, extraOpts ...trace.SpanStartOption) error {
+	startTime := time.Now()
+	span := w.startSpan(ctx, operationPublish, &msg, false, extraOpts...)
+	return w.write(ctx, startTime, []kafka.Message{msg}, []trace.Span{span})
+}
+
+// write writes msgs, whose producer spans are spans, started at startTime.
+//
+// The spans are ended once the write returns with the partition and offset
+// Kafka assigned to their message. When the kafka.Writer is asynchronous, the
+// spans of the accepted messages are ended by their delivery reports instead.
+// The duration and failures of the write are recorded in the publish metrics,
+// and the delivered messages by recordDelivery.
+func (w *Writer) write(ctx context.Context, startTime time.Time, msgs []kafka.Message, spans []trace.Span) error {
+	async := w.W.Async
+	tracked := make([]bool, len(msgs))
+	topics := make([]string, len(msgs))
+	for i := range msgs {
+		tracked[i] = w.deliveries.track(&msgs[i], spans[i], async)
+		topics[i] = w.topic(&msgs[i])
 	}
-	span.End()
+
+	err := w.W.WriteMessages(ctx, msgs...)
+
+	errs := messageErrors(err, len(msgs))
+	for i, span := range spans {
+		if tracked[i] && async && err == nil {
+			continue
+		}
+		if !tracked[i] || w.deliveries.untrack(span) {
+			endSpan(span, errs[i])
+		}
+	}
+	w.metrics.recordPublish(ctx, startTime, topics, errs)
 	return err
 }
 
+// WriteMessages starts a producer span for every message and injects it into
+// a copy of that message's headers, so messages may share their headers. The
+// whole call is covered by a publish batch span which is the parent of, and
+// links to, each message span, following the OpenTelemetry messaging
+// conventions for batch publishing. A span context already propagated in the
+// headers of a message is linked from its span instead.
+//
+// When the write fails with kafka.WriteErrors, only the spans of the messages
+// that actually failed record the error. The messages of topics filtered out
+// with the WithTopicFilter option get no span, and the batch span is not
+// started when all of them are.
 func (w *Writer) WriteMessages(ctx context.Context, msgs []kafka.Message) error {
-	return w.W.WriteMessages(ctx, msgs...)
+	if len(msgs) == 0 {
+		return w.W.WriteMessages(ctx, msgs...)
+	}
+
+	startTime := time.Now()
+	// The batch span is only started when some of its messages are traced.
+	batchCtx, batchSpan := passThroughSpan(ctx)
+	if slices.ContainsFunc(msgs, func(msg kafka.Message) bool { return w.TraceConfig.traces(w.topic(&msg)) }) {
+		batchCtx, batchSpan = w.startBatchSpan(ctx, msgs)
+	}
+	spans := make([]trace.Span, len(msgs))
+	for i := range msgs {
+		spans[i] = w.startSpan(batchCtx, operationCreate, &msgs[i], true)
+		if w.TraceConfig.traces(w.topic(&msgs[i])) {
+			batchSpan.AddLink(trace.Link{SpanContext: spans[i].SpanContext()})
+		}
+	}
+
+	err := w.write(ctx, startTime, msgs, spans)
+	endSpan(batchSpan, err)
+
+	return err
 }
 
-func (w *Writer) startSpan(ctx context.Context, msg *kafka.Message) trace.Span {
-	carrier := NewMessageCarrier(msg)
-	psc := w.TraceConfig.Propagator.Extract(ctx, carrier)
+// messageErrors returns the outcome of each of the n messages of a write that
+// failed with err. kafka.WriteErrors is unpacked so that only the messages
+// that actually failed get an error.
+func messageErrors(err error, n int) []error {
+	errs := make([]error, n)
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) && len(writeErrors) == n {
+		copy(errs, writeErrors)
+		return errs
+	}
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (w *Writer) startBatchSpan(ctx context.Context, msgs []kafka.Message) (context.Context, trace.Span) {
+	seen := make(map[string]struct{}, 1)
+	topics := make([]string, 0, 1)
+	for i := range msgs {
+		topic := w.topic(&msgs[i])
+		if _, ok := seen[topic]; !ok {
+			seen[topic] = struct{}{}
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingOperationTypePublish,
+		semconv.MessagingBatchMessageCount(len(msgs)),
+		messagingKafkaBatchTopicsKey.StringSlice(topics),
+	}
+	var destination string
+	if len(topics) == 1 {
+		destination = topics[0]
+		attrs = append(attrs, semconv.MessagingDestinationName(destination))
+	}
+	if w.TraceConfig.LegacyAttributes {
+		attrs = append(attrs, semconv113.MessagingDestinationKindTopic)
+		if destination != "" {
+			attrs = append(attrs, semconv113.MessagingDestinationKey.String(destination))
+		}
+	}
 
+	shared := &kafka.Message{Topic: destination}
 	opts := w.TraceConfig.MergedSpanStartOptions(
-		trace.WithAttributes(
-			semconv.MessagingDestinationKey.String(msg.Topic),
-			semconv.MessagingMessageIDKey.String(strconv.FormatInt(msg.Offset, 10)),
-			semconv.MessagingKafkaMessageKeyKey.String(string(msg.Key)),
-			semconv.MessagingKafkaPartitionKey.Int64(int64(msg.Partition)),
-		),
+		trace.WithAttributes(attrs...),
 		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(w.TraceConfig.derivedAttributes(shared)...),
 	)
 
-	name := fmt.Sprintf("%s send", msg.Topic)
-	tracerCtx, span := w.TraceConfig.Tracer.Start(psc, name, opts...)
+	return w.TraceConfig.startSpan(ctx, operationPublish, shared, opts...)
+}
 
+// startSpan starts the span of msg with extraOpts, and injects it into msg.
+// The span is a child of the span context propagated in the headers of msg,
+// if any, and of ctx otherwise. When batched is set, the span is a child of
+// the batch span held by ctx, and links to the propagated span context instead.
+func (w *Writer) startSpan(ctx context.Context, operation string, msg *kafka.Message, batched bool, extraOpts ...trace.SpanStartOption) trace.Span {
+	if !w.TraceConfig.traces(w.topic(msg)) {
+		_, span := passThroughSpan(ctx)
+		return span
+	}
+
+	carrier := NewMessageCarrier(msg)
+	psc := w.TraceConfig.Propagator.Extract(ctx, carrier)
+	var links []trace.Link
+	if batched {
+		if sc := trace.SpanContextFromContext(psc); sc.IsValid() && !sc.Equal(trace.SpanContextFromContext(ctx)) {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+		psc = trace.ContextWithSpan(psc, trace.SpanFromContext(ctx))
+	}
+
+	// Describe msg with the topic it is written to, which may be that of w.W.
+	described := msg
+	if msg.Topic == "" {
+		withTopic := *msg
+		withTopic.Topic = w.topic(msg)
+		described = &withTopic
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(w.TraceConfig.messageAttributes(operation, described)...),
+		trace.WithAttributes(w.TraceConfig.headerAttributes(msg)...),
+		trace.WithAttributes(w.TraceConfig.baggageAttributes(psc)...),
+		trace.WithLinks(links...),
+		trace.WithSpanKind(trace.SpanKindProducer),
+	}
+	opts = append(opts, extraOpts...)
+	opts = append(opts, trace.WithAttributes(w.TraceConfig.derivedAttributes(described)...))
+	opts = w.TraceConfig.MergedSpanStartOptions(opts...)
+
+	tracerCtx, span := w.TraceConfig.startSpan(psc, operation, described, opts...)
+
+	// msg may share its headers with other messages, such as those forwarded
+	// from a consumed message, so they are copied before the span is injected.
+	msg.Headers = slices.Clone(msg.Headers)
 	w.TraceConfig.Propagator.Inject(tracerCtx, carrier)
 	return span
 }
+
+// topic returns the topic msg is written to, which is that of w.W when msg
+// has none.
+func (w *Writer) topic(msg *kafka.Message) string {
+	if msg.Topic == "" {
+		return w.W.Topic
+	}
+	return msg.Topic
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	recordError(span, err)
+	span.End()
+}
+
+// recordError records err on span, if any.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,633 @@
+package otelkafkakonsumer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeTransport is a kafka.RoundTripper answering metadata and produce
+// requests in memory, so a kafka.Writer can be used without a broker.
+type fakeTransport struct {
+	mu      sync.Mutex
+	errors  map[string]kafka.Error
+	offsets map[string]int64
+}
+
+func (f *fakeTransport) RoundTrip(_ context.Context, _ net.Addr, req kafka.Request) (kafka.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{
+			Brokers: []metadataAPI.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}},
+		}
+		for _, topic := range r.TopicNames {
+			res.Topics = append(res.Topics, metadataAPI.ResponseTopic{
+				Name:       topic,
+				Partitions: []metadataAPI.ResponsePartition{{PartitionIndex: 0, LeaderID: 1}},
+			})
+		}
+		return res, nil
+	case *produceAPI.Request:
+		res := &produceAPI.Response{}
+		for _, t := range r.Topics {
+			rt := produceAPI.ResponseTopic{Topic: t.Topic}
+			for _, p := range t.Partitions {
+				if f.offsets == nil {
+					f.offsets = map[string]int64{}
+				}
+				rt.Partitions = append(rt.Partitions, produceAPI.ResponsePartition{
+					Partition:  p.Partition,
+					ErrorCode:  int16(f.errors[t.Topic]),
+					BaseOffset: f.offsets[t.Topic],
+				})
+				f.offsets[t.Topic] += int64(countRecords(p.RecordSet.Records))
+			}
+			res.Topics = append(res.Topics, rt)
+		}
+		return res, nil
+	default:
+		return nil, errors.New("unexpected request")
+	}
+}
+
+func countRecords(records protocol.RecordReader) int {
+	n := 0
+	for {
+		if _, err := records.ReadRecord(); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func newTestWriter(t *testing.T, transport *fakeTransport, configure ...func(*kafka.Writer)) (*Writer, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	kw := &kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Transport:    transport,
+		RequiredAcks: kafka.RequireOne,
+		BatchTimeout: time.Millisecond,
+		MaxAttempts:  1,
+	}
+	for _, c := range configure {
+		c(kw)
+	}
+	w, err := NewWriter(kw,
+		WithTracerProvider(tp),
+		WithPropagator(propagation.TraceContext{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	return w, sr
+}
+
+func spansByName(spans []sdktrace.ReadOnlySpan, name string) []sdktrace.ReadOnlySpan {
+	var out []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Name() == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestWriterWriteMessagesBatch(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{})
+	msgs := []kafka.Message{
+		{Topic: "orders", Value: []byte("1")},
+		{Topic: "payments", Value: []byte("2")},
+		{Topic: "orders", Value: []byte("3")},
+	}
+
+	// When
+	err := w.WriteMessages(context.Background(), msgs)
+
+	// Then
+	assert.NoError(t, err)
+	spans := sr.Ended()
+	batch := spansByName(spans, "publish")
+	if !assert.Len(t, batch, 1) {
+		return
+	}
+	assert.Contains(t, batch[0].Attributes(), semconv.MessagingBatchMessageCount(3))
+	assert.Contains(t, batch[0].Attributes(), messagingKafkaBatchTopicsKey.StringSlice([]string{"orders", "payments"}))
+	assert.Equal(t, trace.SpanKindProducer, batch[0].SpanKind())
+	assert.Contains(t, batch[0].Attributes(), semconv.ServerAddress("localhost"))
+
+	messageSpans := append(spansByName(spans, "create orders"), spansByName(spans, "create payments")...)
+	assert.Len(t, messageSpans, 3)
+	links := batch[0].Links()
+	if assert.Len(t, links, 3) {
+		for i := range msgs {
+			sc := propagation.TraceContext{}.Extract(context.Background(), NewMessageCarrier(&msgs[i]))
+			assert.Equal(t, trace.SpanContextFromContext(sc).SpanID(), links[i].SpanContext.SpanID())
+		}
+	}
+	for _, s := range messageSpans {
+		assert.Equal(t, codes.Unset, s.Status().Code)
+		assert.Equal(t, batch[0].SpanContext(), s.Parent())
+	}
+}
+
+func TestWriterWriteMessagesWithSharedHeaders(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{offsets: map[string]int64{"orders": 10}})
+	producer := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	forwarded := kafka.Message{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), producer), NewMessageCarrier(&forwarded))
+	headers := append(forwarded.Headers, kafka.Header{Key: "x", Value: []byte("y")})
+	msgs := []kafka.Message{
+		{Topic: "orders", Value: []byte("1"), Headers: headers},
+		{Topic: "orders", Value: []byte("2"), Headers: headers},
+		{Topic: "orders", Value: []byte("3"), Headers: headers},
+	}
+
+	// When
+	err := w.WriteMessages(context.Background(), msgs)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, producer.SpanID(), trace.SpanContextFromContext(
+		propagation.TraceContext{}.Extract(context.Background(), NewMessageCarrier(&kafka.Message{Headers: headers})),
+	).SpanID())
+	batch := spansByName(sr.Ended(), "publish orders")
+	spans := spansByName(sr.Ended(), "create orders")
+	if !assert.Len(t, batch, 1) || !assert.Len(t, spans, 3) {
+		return
+	}
+	for i, s := range spans {
+		sc := propagation.TraceContext{}.Extract(context.Background(), NewMessageCarrier(&msgs[i]))
+		assert.Equal(t, s.SpanContext().SpanID(), trace.SpanContextFromContext(sc).SpanID())
+		assert.Equal(t, batch[0].SpanContext(), s.Parent())
+		if links := s.Links(); assert.Len(t, links, 1) {
+			assert.Equal(t, producer.SpanID(), links[0].SpanContext.SpanID())
+		}
+		assert.Contains(t, s.Attributes(), semconv.MessagingKafkaOffset(10+i))
+	}
+}
+
+func TestWriterWriteMessagesPartialFailure(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{
+		errors: map[string]kafka.Error{"payments": kafka.MessageSizeTooLarge},
+	})
+	msgs := []kafka.Message{
+		{Topic: "orders", Value: []byte("1")},
+		{Topic: "payments", Value: []byte("2")},
+	}
+
+	// When
+	err := w.WriteMessages(context.Background(), msgs)
+
+	// Then
+	var writeErrors kafka.WriteErrors
+	assert.ErrorAs(t, err, &writeErrors)
+	spans := sr.Ended()
+	if orders := spansByName(spans, "create orders"); assert.Len(t, orders, 1) {
+		assert.Equal(t, codes.Unset, orders[0].Status().Code)
+	}
+	if payments := spansByName(spans, "create payments"); assert.Len(t, payments, 1) {
+		assert.Equal(t, codes.Error, payments[0].Status().Code)
+		assert.Len(t, payments[0].Events(), 1)
+	}
+	if batch := spansByName(spans, "publish"); assert.Len(t, batch, 1) {
+		assert.Equal(t, codes.Error, batch[0].Status().Code)
+	}
+}
+
+func TestWriterWriteMessagesFailure(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{})
+	w.W.Addr = nil
+	msgs := []kafka.Message{
+		{Topic: "orders", Value: []byte("1")},
+		{Topic: "orders", Value: []byte("2")},
+	}
+
+	// When
+	err := w.WriteMessages(context.Background(), msgs)
+
+	// Then
+	assert.Error(t, err)
+	spans := sr.Ended()
+	assert.Len(t, spans, 3)
+	for _, s := range spans {
+		assert.Equal(t, codes.Error, s.Status().Code)
+	}
+}
+
+func TestWriterRecordsMetrics(t *testing.T) {
+	// Given
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Transport:    &fakeTransport{errors: map[string]kafka.Error{"payments": kafka.MessageSizeTooLarge}},
+		RequiredAcks: kafka.RequireOne,
+		BatchTimeout: time.Millisecond,
+		MaxAttempts:  1,
+	}, WithMeterProvider(mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// When
+	_ = w.WriteMessages(context.Background(), []kafka.Message{
+		{Topic: "orders", Value: []byte("123")},
+		{Topic: "payments", Value: []byte("4")},
+	})
+
+	// Then
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+
+	orders := attribute.NewSet(
+		metricSystemKafka,
+		metricOperationKey.String(operationPublish),
+		metricTopicKey.String("orders"),
+		metricPartitionKey.String("0"),
+	)
+	payments := attribute.NewSet(
+		metricSystemKafka,
+		metricOperationKey.String(operationPublish),
+		metricTopicKey.String("payments"),
+	)
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints:  []metricdata.DataPoint[int64]{{Attributes: orders, Value: 1}},
+	}, got[publishMessagesName], metricdatatest.IgnoreTimestamp())
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints:  []metricdata.DataPoint[int64]{{Attributes: orders, Value: 3}},
+	}, got[publishBytesName], metricdatatest.IgnoreTimestamp())
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints:  []metricdata.DataPoint[int64]{{Attributes: payments, Value: 1}},
+	}, got[errorsName], metricdatatest.IgnoreTimestamp())
+	if h, ok := got[publishDurationName].(metricdata.Histogram[float64]); assert.True(t, ok) {
+		assert.Len(t, h.DataPoints, 2)
+	}
+}
+
+func TestWriterRecordsAsyncMetricsWithWriterTopic(t *testing.T) {
+	// Given
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Topic:        "orders",
+		Transport:    &fakeTransport{},
+		RequiredAcks: kafka.RequireOne,
+		BatchTimeout: time.Millisecond,
+		Async:        true,
+	}, WithMeterProvider(mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	err = w.WriteMessage(context.Background(), kafka.Message{Value: []byte("123")})
+	w.Close()
+
+	// Then
+	assert.NoError(t, err)
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+
+	metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+		DataPoints: []metricdata.DataPoint[int64]{{
+			Attributes: attribute.NewSet(
+				metricSystemKafka,
+				metricOperationKey.String(operationPublish),
+				metricTopicKey.String("orders"),
+				metricPartitionKey.String("0"),
+			),
+			Value: 1,
+		}},
+	}, got[publishMessagesName], metricdatatest.IgnoreTimestamp())
+	if h, ok := got[publishDurationName].(metricdata.Histogram[float64]); assert.True(t, ok) && assert.Len(t, h.DataPoints, 1) {
+		topic, _ := h.DataPoints[0].Attributes.Value(metricTopicKey)
+		assert.Equal(t, "orders", topic.AsString())
+	}
+}
+
+func TestWriterReportsStats(t *testing.T) {
+	// Given
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Topic:        "orders",
+		Transport:    &fakeTransport{},
+		RequiredAcks: kafka.RequireOne,
+		BatchTimeout: time.Millisecond,
+	}, WithMeterProvider(mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	collect := func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]metricdata.Aggregation{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				got[m.Name] = m.Data
+			}
+		}
+		return got
+	}
+	attrs := attribute.NewSet(metricClientIDKey.String(""), metricTopicKey.String("orders"))
+
+	// When
+	_ = w.WriteMessage(context.Background(), kafka.Message{Value: []byte("1")})
+	first := collect()
+	second := collect()
+
+	// Then
+	for _, got := range []map[string]metricdata.Aggregation{first, second} {
+		metricdatatest.AssertAggregationsEqual(t, metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints:  []metricdata.DataPoint[int64]{{Attributes: attrs, Value: 1}},
+		}, got["kafka.writer.message.count"], metricdatatest.IgnoreTimestamp())
+		metricdatatest.AssertAggregationsEqual(t, metricdata.Gauge[int64]{
+			DataPoints: []metricdata.DataPoint[int64]{{Attributes: attrs, Value: int64(kafka.RequireOne)}},
+		}, got["kafka.writer.acks.required"], metricdatatest.IgnoreTimestamp())
+		assert.Contains(t, got, "kafka.writer.batch.seconds.avg")
+		assert.NotContains(t, got, "kafak.reader.fetch.count")
+	}
+}
+
+func TestWriterSetsDeliveredPositionOnSpans(t *testing.T) {
+	// Given
+	var completed []kafka.Message
+	w, sr := newTestWriter(t, &fakeTransport{offsets: map[string]int64{"orders": 10}}, func(kw *kafka.Writer) {
+		kw.Completion = func(messages []kafka.Message, err error) {
+			completed = append(completed, messages...)
+		}
+	})
+
+	// When
+	err := w.WriteMessages(context.Background(), []kafka.Message{
+		{Topic: "orders", Value: []byte("1")},
+		{Topic: "orders", Value: []byte("2")},
+	})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Len(t, completed, 2)
+	spans := spansByName(sr.Ended(), "create orders")
+	if assert.Len(t, spans, 2) {
+		for i, s := range spans {
+			assert.Contains(t, s.Attributes(), semconv.MessagingDestinationPartitionID("0"))
+			assert.Contains(t, s.Attributes(), semconv.MessagingKafkaOffset(10+i))
+		}
+	}
+}
+
+func TestWriterEndsAsyncSpansOnDelivery(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{offsets: map[string]int64{"orders": 3}}, func(kw *kafka.Writer) {
+		kw.Async = true
+	})
+
+	// When
+	err := w.WriteMessage(context.Background(), kafka.Message{Topic: "orders", Value: []byte("1")})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(spansByName(sr.Ended(), "publish orders")) == 1 }, time.Second, time.Millisecond)
+	span := spansByName(sr.Ended(), "publish orders")[0]
+	assert.Contains(t, span.Attributes(), semconv.MessagingKafkaOffset(3))
+	assert.Equal(t, codes.Unset, span.Status().Code)
+}
+
+func TestWriterEndsAsyncSpansWithDeliveryError(t *testing.T) {
+	// Given
+	reported := make(chan error, 1)
+	w, sr := newTestWriter(t, &fakeTransport{errors: map[string]kafka.Error{"orders": kafka.MessageSizeTooLarge}}, func(kw *kafka.Writer) {
+		kw.Async = true
+		kw.Completion = func(_ []kafka.Message, err error) { reported <- err }
+	})
+
+	// When
+	err := w.WriteMessage(context.Background(), kafka.Message{Topic: "orders", Value: []byte("1")})
+	_ = w.Close()
+
+	// Then
+	assert.NoError(t, err)
+	assert.ErrorIs(t, <-reported, kafka.MessageSizeTooLarge)
+	if spans := spansByName(sr.Ended(), "publish orders"); assert.Len(t, spans, 1) {
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Contains(t, spans[0].Status().Description, kafka.MessageSizeTooLarge.Error())
+	}
+}
+
+func TestWriterAddsMessageAttributes(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Transport:    &fakeTransport{},
+		BatchTimeout: time.Millisecond,
+	},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithMessageAttributes(func(msg *kafka.Message) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.Int("value.size", len(msg.Value))}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// When
+	err = w.WriteMessages(context.Background(), []kafka.Message{
+		{Topic: "orders", Value: []byte("123")},
+		{Topic: "payments", Value: []byte("4")},
+	})
+
+	// Then
+	assert.NoError(t, err)
+	spans := sr.Ended()
+	if orders := spansByName(spans, "create orders"); assert.Len(t, orders, 1) {
+		assert.Contains(t, orders[0].Attributes(), attribute.Int("value.size", 3))
+	}
+	if batch := spansByName(spans, "publish"); assert.Len(t, batch, 1) {
+		assert.Contains(t, batch[0].Attributes(), attribute.Int("value.size", 0))
+	}
+}
+
+func TestWriterSkipsFilteredTopics(t *testing.T) {
+	// Given
+	sr := tracetest.NewSpanRecorder()
+	w, err := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Transport:    &fakeTransport{},
+		BatchTimeout: time.Millisecond,
+	},
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		WithPropagator(propagation.TraceContext{}),
+		WithTopicFilter(TopicsNotMatching(regexp.MustCompile(`^audit$`))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	msgs := []kafka.Message{
+		{Topic: "audit", Value: []byte("1")},
+		{Topic: "orders", Value: []byte("2")},
+	}
+
+	// When
+	err = w.WriteMessages(context.Background(), msgs)
+	assert.NoError(t, err)
+	err = w.WriteMessages(context.Background(), []kafka.Message{{Topic: "audit", Value: []byte("3")}})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, msgs[0].Headers)
+	assert.NotEmpty(t, msgs[1].Headers)
+	spans := sr.Ended()
+	assert.Len(t, spans, 2)
+	assert.Len(t, spansByName(spans, "create orders"), 1)
+	if batch := spansByName(spans, "publish"); assert.Len(t, batch, 1) {
+		assert.Len(t, batch[0].Links(), 1)
+	}
+}
+
+func TestWriterDescribesMessagesWithWriterTopic(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{}, func(kw *kafka.Writer) { kw.Topic = "orders" })
+
+	// When
+	err := w.WriteMessage(context.Background(), kafka.Message{Value: []byte("1")})
+
+	// Then
+	assert.NoError(t, err)
+	if publish := spansByName(sr.Ended(), "publish orders"); assert.Len(t, publish, 1) {
+		assert.Contains(t, publish[0].Attributes(), semconv.MessagingDestinationName("orders"))
+	}
+}
+
+func TestWriterBatchSpanUsesWriterTopic(t *testing.T) {
+	// Given
+	w, sr := newTestWriter(t, &fakeTransport{}, func(kw *kafka.Writer) { kw.Topic = "orders" })
+
+	// When
+	err := w.WriteMessages(context.Background(), []kafka.Message{{Value: []byte("1")}, {Value: []byte("2")}})
+
+	// Then
+	assert.NoError(t, err)
+	if batch := spansByName(sr.Ended(), "publish orders"); assert.Len(t, batch, 1) {
+		assert.Contains(t, batch[0].Attributes(), messagingKafkaBatchTopicsKey.StringSlice([]string{"orders"}))
+		assert.Contains(t, batch[0].Attributes(), semconv.MessagingDestinationName("orders"))
+	}
+	assert.Len(t, spansByName(sr.Ended(), "create orders"), 2)
+}
+
+func TestWriterPropagatesContextOfUnsampledSpans(t *testing.T) {
+	for _, decision := range []SamplingDecision{SamplingDrop, SamplingNonRecording} {
+		// Given
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		w, err := NewWriter(&kafka.Writer{
+			Addr:         kafka.TCP("localhost:9092"),
+			Transport:    &fakeTransport{},
+			BatchTimeout: time.Millisecond,
+		},
+			WithTracerProvider(tp),
+			WithPropagator(propagation.TraceContext{}),
+			WithMessageSampler(func(string, *kafka.Message) SamplingDecision { return decision }),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+		msgs := []kafka.Message{{Topic: "orders", Value: []byte("1")}}
+
+		// When
+		err = w.WriteMessages(ctx, msgs)
+		parent.End()
+		_ = w.Close()
+
+		// Then
+		assert.NoError(t, err)
+		sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), NewMessageCarrier(&msgs[0])))
+		assert.Equal(t, parent.SpanContext().TraceID(), sc.TraceID(), "decision %d", decision)
+		if decision == SamplingDrop {
+			assert.Equal(t, parent.SpanContext().SpanID(), sc.SpanID())
+		} else {
+			assert.False(t, sc.IsSampled())
+		}
+		assert.Len(t, sr.Ended(), 1)
+	}
+}
+
+func TestNewWriterWithoutKafkaWriter(t *testing.T) {
+	// When
+	w, err := NewWriter(nil, WithTracerProvider(sdktrace.NewTracerProvider()))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Nil(t, w.stats)
+	assert.NotPanics(t, w.stats.unregister)
+}